@@ -0,0 +1,454 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/hts.h"
+#include "htslib/kstring.h"
+#include "htslib/sam.h"
+
+hts_itr_t *isam_itr_queryi(hts_idx_t *idx, int tid, int64_t beg, int64_t end){
+	return sam_itr_queryi(idx, tid, beg, end);
+}
+
+hts_itr_t *isam_itr_querys(hts_idx_t *idx, bam_hdr_t *hdr, char *s){
+	return sam_itr_querys(idx, hdr, s);
+}
+
+int isam_itr_next(htsFile *fp, hts_itr_t *iter, bam1_t *b){
+	return sam_itr_next(fp, iter, b);
+}
+
+char *bam_tid2name(bam_hdr_t *h, int tid) {
+	if (tid < 0 || tid >= h->n_targets) return NULL;
+	return h->target_name[tid];
+}
+
+char *bam_qname(bam1_t *b) {
+	return bam_get_qname(b);
+}
+
+void bam_cigar_str(bam1_t *b, kstring_t *s) {
+	uint32_t *cigar = bam_get_cigar(b);
+	int i;
+	for (i = 0; i < b->core.n_cigar; ++i) {
+		kputw(bam_cigar_oplen(cigar[i]), s);
+		kputc(bam_cigar_opchr(cigar[i]), s);
+	}
+}
+
+void bam_seq_str(bam1_t *b, char *out) {
+	uint8_t *seq = bam_get_seq(b);
+	int i;
+	for (i = 0; i < b->core.l_qseq; ++i) {
+		out[i] = seq_nt16_str[bam_seqi(seq, i)];
+	}
+}
+*/
+import "C"
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/brentp/irelate/interfaces"
+)
+
+// BamOptions configures NewBamReader.
+type BamOptions struct {
+	// Reference is the FASTA used to decode CRAM files.
+	Reference string
+	// IndexPath is the .bai, .csi or .crai index. If empty, htslib looks for
+	// it next to the file.
+	IndexPath string
+}
+
+// BamReader queries regions of an indexed BAM or CRAM file.
+type BamReader struct {
+	path      string
+	reference string
+	hdr       *C.bam_hdr_t
+	idx       *C.hts_idx_t
+
+	// mu guards the header and index, which are freed by Close. Reads hold
+	// it for reading so that queries can run concurrently, each on its own
+	// htsFile from idle.
+	mu     sync.RWMutex
+	closed bool
+	poolMu sync.Mutex
+	idle   []*C.htsFile
+}
+
+func bamCloser(b *BamReader) {
+	b.Close()
+}
+
+// NewBamReader opens an indexed BAM or CRAM.
+func NewBamReader(path string, opts BamOptions) (*BamReader, error) {
+	b := &BamReader{path: path, reference: opts.Reference}
+	htf, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(b, bamCloser)
+	// the first handle reads the header and then serves queries.
+	b.idle = append(b.idle, htf)
+	b.hdr = C.sam_hdr_read(htf)
+	if b.hdr == nil {
+		return nil, fmt.Errorf("unable to read header from %s", path)
+	}
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	if opts.IndexPath != "" {
+		ci := C.CString(opts.IndexPath)
+		defer C.free(unsafe.Pointer(ci))
+		b.idx = C.sam_index_load2(htf, cs, ci)
+	} else {
+		b.idx = C.sam_index_load(htf, cs)
+	}
+	if b.idx == nil {
+		return nil, fmt.Errorf("unable to load index for %s", path)
+	}
+	return b, nil
+}
+
+// open opens a new handle on the file, using the reference for CRAM.
+func (b *BamReader) open() (*C.htsFile, error) {
+	cs := C.CString(b.path)
+	defer C.free(unsafe.Pointer(cs))
+	mode := C.CString("r")
+	defer C.free(unsafe.Pointer(mode))
+	htf := C.hts_open(cs, mode)
+	if htf == nil {
+		return nil, fmt.Errorf("unable to open %s", b.path)
+	}
+	if b.reference != "" {
+		cref := C.CString(b.reference)
+		defer C.free(unsafe.Pointer(cref))
+		if C.hts_set_fai_filename(htf, cref) != 0 {
+			C.hts_close(htf)
+			return nil, fmt.Errorf("unable to use reference %s for %s", b.reference, b.path)
+		}
+	}
+	return htf, nil
+}
+
+// Close frees the index and header and closes the files. It waits for reads
+// in progress; iteration then stops and later queries return ErrClosed.
+// Alignments already returned remain valid. Calling Close more than once is a
+// no-op.
+func (b *BamReader) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	runtime.SetFinalizer(b, nil)
+	if b.idx != nil {
+		C.hts_idx_destroy(b.idx)
+		b.idx = nil
+	}
+	if b.hdr != nil {
+		C.bam_hdr_destroy(b.hdr)
+		b.hdr = nil
+	}
+	b.poolMu.Lock()
+	defer b.poolMu.Unlock()
+	var err error
+	for _, htf := range b.idle {
+		if C.hts_close(htf) != 0 {
+			err = fmt.Errorf("cgotabix: error closing %s", b.path)
+		}
+	}
+	b.idle = nil
+	return err
+}
+
+// acquire returns an idle file handle, opening a new one if all are in use.
+func (b *BamReader) acquire() (*C.htsFile, error) {
+	b.poolMu.Lock()
+	if n := len(b.idle); n > 0 {
+		htf := b.idle[n-1]
+		b.idle = b.idle[:n-1]
+		b.poolMu.Unlock()
+		return htf, nil
+	}
+	b.poolMu.Unlock()
+	htf, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	// a CRAM handle can only decode reads once it has read the header.
+	hdr := C.sam_hdr_read(htf)
+	if hdr == nil {
+		C.hts_close(htf)
+		return nil, fmt.Errorf("unable to read header from %s", b.path)
+	}
+	C.bam_hdr_destroy(hdr)
+	return htf, nil
+}
+
+// release returns htf to the pool or closes it if b has been closed.
+func (b *BamReader) release(htf *C.htsFile) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		C.hts_close(htf)
+		return
+	}
+	b.poolMu.Lock()
+	b.idle = append(b.idle, htf)
+	b.poolMu.Unlock()
+}
+
+// Get returns the alignments that overlap q. It returns no alignments after
+// Close. Other errors are logged and the alignments read before them are
+// returned; use Query to handle them.
+func (b *BamReader) Get(q interfaces.IPosition) []interfaces.IPosition {
+	overlaps, err := b.Query(q)
+	logDropped(b.path, err)
+	return overlaps
+}
+
+// Query returns the alignments that overlap q or ErrClosed after Close.
+func (b *BamReader) Query(q interfaces.IPosition) ([]interfaces.IPosition, error) {
+	overlaps := make([]interfaces.IPosition, 0, 16)
+	itr, err := b.queryi(q.Chrom(), q.Start(), q.End())
+	if err != nil || itr == nil {
+		return overlaps, err
+	}
+	htf, err := b.acquire()
+	if err != nil {
+		C.hts_itr_destroy(itr)
+		return overlaps, err
+	}
+	var a *Alignment
+	for {
+		a, err = b.next(htf, itr)
+		if a == nil {
+			break
+		}
+		overlaps = append(overlaps, a)
+	}
+	C.hts_itr_destroy(itr)
+	b.release(htf)
+	return overlaps, err
+}
+
+// At takes a region like 1:45678-56789 and returns a channel on which
+// it sends an *Alignment for each read that overlaps the region.
+// The channel is closed early if the BamReader is closed or on an error,
+// which is logged. The caller must drain the channel; use AtContext to stop
+// early or to handle errors.
+func (b *BamReader) At(region string) interfaces.RelatableChannel {
+	out, errc := b.AtContext(context.Background(), region)
+	go func() { logDropped(b.path, <-errc) }()
+	return out
+}
+
+// AtContext is like At but stops when ctx is done, freeing the query and
+// closing the channel. Once the channel is closed the error channel yields
+// the reason iteration ended: nil at the end of the region, ctx.Err(),
+// ErrClosed or a read error.
+func (b *BamReader) AtContext(ctx context.Context, region string) (interfaces.RelatableChannel, <-chan error) {
+	out := make(interfaces.RelatableChannel, 20)
+	errc := make(chan error, 1)
+	itr, err := b.querys(region)
+	var htf *C.htsFile
+	if err == nil && itr != nil {
+		if htf, err = b.acquire(); err != nil {
+			C.hts_itr_destroy(itr)
+		}
+	}
+	if err != nil || itr == nil {
+		close(out)
+		errc <- err
+		close(errc)
+		return out, errc
+	}
+
+	go func() {
+		var err error
+		defer func() {
+			C.hts_itr_destroy(itr)
+			b.release(htf)
+			close(out)
+			errc <- err
+			close(errc)
+		}()
+		for {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			var a *Alignment
+			if a, err = b.next(htf, itr); a == nil {
+				return
+			}
+			select {
+			case out <- a:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// queryi returns an iterator over chrom:start-end or nil if chrom is not in
+// the header.
+func (b *BamReader) queryi(chrom string, start, end uint32) (*C.hts_itr_t, error) {
+	ch := C.CString(chrom)
+	defer C.free(unsafe.Pointer(ch))
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	tid := C.bam_name2id(b.hdr, ch)
+	if tid < 0 {
+		return nil, nil
+	}
+	return C.isam_itr_queryi(b.idx, tid, C.int64_t(start), C.int64_t(end)), nil
+}
+
+// querys returns an iterator over a region like 1:45678-56789, nil if its
+// chromosome is not in the header or an error if it can't be parsed.
+func (b *BamReader) querys(region string) (*C.hts_itr_t, error) {
+	cs := C.CString(region)
+	defer C.free(unsafe.Pointer(cs))
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if itr := C.isam_itr_querys(b.idx, b.hdr, cs); itr != nil {
+		return itr, nil
+	}
+	chrom := region
+	if i := strings.LastIndexByte(region, ':'); i >= 0 && !b.hasChrom(region) {
+		chrom = region[:i]
+	}
+	if !b.hasChrom(chrom) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cgotabix: invalid region %q for %s", region, b.path)
+}
+
+// hasChrom reports whether chrom is in the header. mu must be held.
+func (b *BamReader) hasChrom(chrom string) bool {
+	cs := C.CString(chrom)
+	defer C.free(unsafe.Pointer(cs))
+	return C.bam_name2id(b.hdr, cs) >= 0
+}
+
+// next reads the next alignment of itr from htf. It returns nil at the end
+// of the region and ErrClosed once b is closed.
+func (b *BamReader) next(htf *C.htsFile, itr *C.hts_itr_t) (*Alignment, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	r := C.bam_init1()
+	if ret := C.isam_itr_next(htf, itr, r); ret < 0 {
+		C.bam_destroy1(r)
+		if ret == -1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cgotabix: error reading %s (%d)", b.path, int(ret))
+	}
+	return newAlignment(r, C.GoString(C.bam_tid2name(b.hdr, r.core.tid))), nil
+}
+
+// Alignment is a read from a BAM or CRAM file.
+type Alignment struct {
+	b       *C.bam1_t
+	chrom   string
+	source  uint32
+	related []interfaces.Relatable
+}
+
+func newAlignment(b *C.bam1_t, chrom string) *Alignment {
+	a := &Alignment{b: b, chrom: chrom, source: 1}
+	runtime.SetFinalizer(a, alignmentFinalizer)
+	return a
+}
+
+func alignmentFinalizer(a *Alignment) {
+	C.bam_destroy1(a.b)
+}
+
+func (a *Alignment) Chrom() string {
+	return a.chrom
+}
+
+func (a *Alignment) Start() uint32 {
+	return uint32(a.b.core.pos)
+}
+
+// End is the end of the alignment on the reference as given by the CIGAR.
+func (a *Alignment) End() uint32 {
+	return uint32(C.bam_endpos(a.b))
+}
+
+func (a *Alignment) Name() string {
+	return C.GoString(C.bam_qname(a.b))
+}
+
+// Flag is the SAM flag of the read.
+func (a *Alignment) Flag() uint16 {
+	return uint16(a.b.core.flag)
+}
+
+func (a *Alignment) MapQ() uint8 {
+	return uint8(a.b.core.qual)
+}
+
+// IsReverse is true when the read is aligned to the reverse strand.
+func (a *Alignment) IsReverse() bool {
+	return a.Flag()&C.BAM_FREVERSE != 0
+}
+
+func (a *Alignment) Cigar() string {
+	kstr := C.kstring_t{}
+	C.bam_cigar_str(a.b, &kstr)
+	v := C.GoStringN(kstr.s, C.int(kstr.l))
+	C.free(unsafe.Pointer(kstr.s))
+	return v
+}
+
+// Sequence returns the bases of the read or "" if they aren't stored.
+func (a *Alignment) Sequence() string {
+	l := int(a.b.core.l_qseq)
+	if l <= 0 {
+		return ""
+	}
+	buf := C.malloc(C.size_t(l))
+	C.bam_seq_str(a.b, (*C.char)(buf))
+	v := C.GoStringN((*C.char)(buf), C.int(l))
+	C.free(buf)
+	return v
+}
+
+func (a *Alignment) Source() uint32 {
+	return a.source
+}
+
+func (a *Alignment) SetSource(s uint32) {
+	a.source = s
+}
+
+func (a *Alignment) Related() []interfaces.Relatable {
+	return a.related
+}
+
+func (a *Alignment) AddRelated(i interfaces.Relatable) {
+	if a.related == nil {
+		a.related = make([]interfaces.Relatable, 0)
+	}
+	a.related = append(a.related, i)
+}
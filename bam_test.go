@@ -0,0 +1,198 @@
+package cgotabix
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/brentp/irelate/interfaces"
+	. "gopkg.in/check.v1"
+)
+
+// test.bam and test.cram hold reads on test.fa; the CRAM reads match the
+// reference so their bases can only be decoded with it.
+
+func alignments(rs []interfaces.IPosition) []*Alignment {
+	as := make([]*Alignment, len(rs))
+	for i, r := range rs {
+		as[i] = r.(*Alignment)
+	}
+	return as
+}
+
+func alignmentNames(as []*Alignment) []string {
+	ns := make([]string, len(as))
+	for i, a := range as {
+		ns[i] = a.Name()
+	}
+	return ns
+}
+
+func (s *TSuite) TestBamReaderMissing(c *C) {
+	_, err := NewBamReader("does-not-exist.bam", BamOptions{})
+	c.Assert(err, NotNil)
+}
+
+func (s *TSuite) TestBamReaderGet(c *C) {
+	b, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	defer b.Close()
+
+	as := alignments(b.Get(Position{"chr1", 25, 65}))
+	c.Assert(alignmentNames(as), DeepEquals, []string{"r1", "r2", "r3"})
+
+	a := as[1]
+	c.Assert(a.Chrom(), Equals, "chr1")
+	c.Assert(a.Start(), Equals, uint32(30))
+	c.Assert(a.End(), Equals, uint32(51))
+	c.Assert(a.Cigar(), Equals, "5M2I8M3D5M")
+	c.Assert(a.Sequence(), Equals, "TAGGGTTATATAGGCGACAT")
+	c.Assert(a.Flag(), Equals, uint16(16))
+	c.Assert(a.IsReverse(), Equals, true)
+	c.Assert(a.MapQ(), Equals, uint8(30))
+
+	a = as[2]
+	c.Assert(a.Start(), Equals, uint32(60))
+	c.Assert(a.End(), Equals, uint32(76))
+	c.Assert(a.Cigar(), Equals, "4S16M")
+	c.Assert(a.Sequence(), Equals, "GGGGCCCTTGCGACAGTGAC")
+	c.Assert(a.IsReverse(), Equals, false)
+
+	as = alignments(b.Get(Position{"chr2", 0, 100}))
+	c.Assert(alignmentNames(as), DeepEquals, []string{"r5"})
+	c.Assert(as[0].Chrom(), Equals, "chr2")
+	c.Assert(as[0].End(), Equals, uint32(17))
+
+	c.Assert(b.Get(Position{"chr1", 80, 150}), HasLen, 0)
+	c.Assert(b.Get(Position{"chr3", 0, 100}), HasLen, 0)
+}
+
+func (s *TSuite) TestBamReaderAt(c *C) {
+	b, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	defer b.Close()
+
+	var as []*Alignment
+	for r := range b.At("chr1:151-160") {
+		as = append(as, r.(*Alignment))
+	}
+	c.Assert(alignmentNames(as), DeepEquals, []string{"r4"})
+	c.Assert(as[0].Cigar(), Equals, "30M")
+	c.Assert(as[0].End(), Equals, uint32(180))
+
+	n := 0
+	for range b.At("chr1") {
+		n++
+	}
+	c.Assert(n, Equals, 4)
+}
+
+func (s *TSuite) TestBamReaderClose(c *C) {
+	b, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	a := b.Get(Position{"chr2", 0, 100})[0].(*Alignment)
+	c.Assert(b.Close(), IsNil)
+	c.Assert(b.Close(), IsNil)
+
+	c.Assert(a.Name(), Equals, "r5")
+	c.Assert(b.Get(Position{"chr1", 0, 100}), HasLen, 0)
+	_, err = b.Query(Position{"chr1", 0, 100})
+	c.Assert(err, Equals, ErrClosed)
+	n := 0
+	for range b.At("chr1") {
+		n++
+	}
+	c.Assert(n, Equals, 0)
+}
+
+func (s *TSuite) TestBamReaderConcurrent(c *C) {
+	b, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	// an unfinished At holds its own handle.
+	ch := b.At("chr1")
+	<-ch
+
+	var wg sync.WaitGroup
+	names := make([][]string, 8)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 20; k++ {
+				as := alignments(b.Get(Position{"chr1", 25, 65}))
+				names[i] = append(names[i], alignmentNames(as)...)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, ns := range names {
+		c.Assert(ns, HasLen, 3*20)
+		c.Assert(ns[:3], DeepEquals, []string{"r1", "r2", "r3"})
+	}
+	n := 1
+	for range ch {
+		n++
+	}
+	c.Assert(n, Equals, 4)
+	c.Assert(b.Close(), IsNil)
+}
+
+func (s *TSuite) TestBamReaderAtContext(c *C) {
+	b, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch, errc := b.AtContext(ctx, "chr1")
+	for range ch {
+	}
+	c.Assert(<-errc, Equals, context.Canceled)
+	// the handle went back to the pool.
+	c.Assert(b.idle, HasLen, 1)
+
+	ch, errc = b.AtContext(context.Background(), "chr1:100-50")
+	_, ok := <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, NotNil)
+	ch, errc = b.AtContext(context.Background(), "chr3:1-100")
+	_, ok = <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, IsNil)
+
+	c.Assert(b.Close(), IsNil)
+	ch, errc = b.AtContext(context.Background(), "chr1")
+	_, ok = <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, Equals, ErrClosed)
+}
+
+func (s *TSuite) TestCramReference(c *C) {
+	f, err := NewFasta("test.fa")
+	c.Assert(err, IsNil)
+	defer f.Close()
+	b, err := NewBamReader("test.cram", BamOptions{Reference: "test.fa"})
+	c.Assert(err, IsNil)
+	defer b.Close()
+
+	as := alignments(b.Get(Position{"chr1", 0, 240}))
+	c.Assert(alignmentNames(as), DeepEquals, []string{"r1", "r4"})
+	as = append(as, alignments(b.Get(Position{"chr2", 0, 100}))...)
+	c.Assert(alignmentNames(as), DeepEquals, []string{"r1", "r4", "r5"})
+	for _, a := range as {
+		seq, err := f.Fetch(a.Chrom(), a.Start(), a.End())
+		c.Assert(err, IsNil)
+		c.Assert(a.Sequence(), Equals, seq)
+		c.Assert(a.Cigar(), Equals, fmt.Sprintf("%dM", len(seq)))
+	}
+	c.Assert(as[2].IsReverse(), Equals, true)
+
+	// the same reads as in the BAM.
+	bam, err := NewBamReader("test.bam", BamOptions{})
+	c.Assert(err, IsNil)
+	defer bam.Close()
+	r4 := alignments(bam.Get(Position{"chr1", 150, 151}))[0]
+	c.Assert(as[1].Start(), Equals, r4.Start())
+	c.Assert(as[1].Sequence(), Equals, r4.Sequence())
+
+	_, err = NewBamReader("test.cram", BamOptions{Reference: "does-not-exist.fa"})
+	c.Assert(err, NotNil)
+}
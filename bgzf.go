@@ -0,0 +1,123 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/bgzf.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// BGZFOptions configures a BGZFWriter.
+type BGZFOptions struct {
+	// Level is the compression level as in compress/gzip: -1 for the zlib
+	// default, 0 for no compression up to 9 for the best compression.
+	Level int
+	// Threads is the number of threads used for compression. Values <= 1
+	// compress in the calling goroutine.
+	Threads int
+	// Index, if not nil, is used to build a tabix index of the file on Close.
+	Index *Preset
+	// MinShift > 0 makes Close build a .csi rather than a .tbi index.
+	MinShift int
+}
+
+// BGZFWriter writes a bgzip compressed file that can be indexed by tabix.
+type BGZFWriter struct {
+	path string
+	fp   *C.BGZF
+	opts BGZFOptions
+}
+
+var errClosedWriter = errors.New("cgotabix: write to closed writer")
+
+func bgzfWriterCloser(w *BGZFWriter) {
+	if w.fp != nil {
+		C.bgzf_close(w.fp)
+	}
+}
+
+// NewBGZFWriter creates the file at path and returns a BGZFWriter for it.
+// A nil opts uses the default compression level with a single thread and
+// builds no index.
+func NewBGZFWriter(path string, opts *BGZFOptions) (*BGZFWriter, error) {
+	w := &BGZFWriter{path: path, opts: BGZFOptions{Level: -1}}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Level < -1 || w.opts.Level > 9 {
+		return nil, fmt.Errorf("cgotabix: invalid compression level %d", w.opts.Level)
+	}
+	mode := "w"
+	if w.opts.Level >= 0 {
+		mode = fmt.Sprintf("w%d", w.opts.Level)
+	}
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	cmode := C.CString(mode)
+	defer C.free(unsafe.Pointer(cmode))
+
+	w.fp = C.bgzf_open(cs, cmode)
+	if w.fp == nil {
+		return nil, fmt.Errorf("cgotabix: unable to open %s for writing", path)
+	}
+	runtime.SetFinalizer(w, bgzfWriterCloser)
+	if w.opts.Threads > 1 {
+		if C.bgzf_mt(w.fp, C.int(w.opts.Threads), 256) != 0 {
+			w.Close()
+			return nil, fmt.Errorf("cgotabix: unable to use %d threads for %s", w.opts.Threads, path)
+		}
+	}
+	return w, nil
+}
+
+// Write compresses p into the file. It implements io.Writer.
+func (w *BGZFWriter) Write(p []byte) (int, error) {
+	if w.fp == nil {
+		return 0, errClosedWriter
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := C.bgzf_write(w.fp, unsafe.Pointer(&p[0]), C.size_t(len(p)))
+	if n < 0 {
+		return 0, fmt.Errorf("cgotabix: error writing to %s", w.path)
+	}
+	return int(n), nil
+}
+
+// Flush compresses and writes any buffered data.
+func (w *BGZFWriter) Flush() error {
+	if w.fp == nil {
+		return errClosedWriter
+	}
+	if C.bgzf_flush(w.fp) != 0 {
+		return fmt.Errorf("cgotabix: error flushing %s", w.path)
+	}
+	return nil
+}
+
+// Close writes the EOF block, closes the file and, if requested in the
+// options, builds its index. Calling Close more than once is a no-op.
+func (w *BGZFWriter) Close() error {
+	if w.fp == nil {
+		return nil
+	}
+	ret := C.bgzf_close(w.fp)
+	w.fp = nil
+	runtime.SetFinalizer(w, nil)
+	if ret != 0 {
+		return fmt.Errorf("cgotabix: error closing %s", w.path)
+	}
+	if w.opts.Index == nil {
+		return nil
+	}
+	if w.opts.MinShift > 0 {
+		return buildIndex(w.path, w.path+".csi", *w.opts.Index, w.opts.MinShift)
+	}
+	return buildIndex(w.path, w.path+".tbi", *w.opts.Index, 0)
+}
@@ -0,0 +1,32 @@
+package cgotabix
+
+import (
+	"fmt"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestBGZFWriter(c *C) {
+	path := filepath.Join(c.MkDir(), "t.bed.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Level: 6, Threads: 2, Index: &PresetBED})
+	c.Assert(err, IsNil)
+	for i := 0; i < 100; i++ {
+		_, err := fmt.Fprintf(w, "chr1\t%d\t%d\n", i*100, i*100+50)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	_, err = w.Write([]byte("chr1\t1\t2\n"))
+	c.Assert(err, NotNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.Get(Position{"chr1", 1000, 1260}), HasLen, 3)
+}
+
+func (s *TSuite) TestBGZFWriterLevel(c *C) {
+	_, err := NewBGZFWriter(filepath.Join(c.MkDir(), "t.gz"), &BGZFOptions{Level: 12})
+	c.Assert(err, NotNil)
+}
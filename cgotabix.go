@@ -4,6 +4,7 @@ package cgotabix
 #cgo LDFLAGS: -lhts -lpthread -lz -lm
 
 #include "stdlib.h"
+#include "string.h"
 #include <zlib.h>
 #include "htslib/hts.h"
 #include "htslib/kstring.h"
@@ -53,14 +54,76 @@ hts_itr_t *tabix_itr_querys(tbx_t *tbx, char *s){
      return hts_itr_querys((tbx)->idx, (s), (hts_name2id_f)(tbx_name2id), (tbx), hts_itr_query, tbx_readrec);
 }
 
-hts_itr_t *tabix_itr_queryi(tbx_t *tbx,  int tid, int beg, int end){
+hts_itr_t *tabix_itr_queryi(tbx_t *tbx,  int tid, int64_t beg, int64_t end){
      return hts_itr_query((tbx)->idx, (tid), (beg), (end), tbx_readrec);
 }
 
+hts_itr_t *ibcf_itr_queryi(hts_idx_t *idx, int tid, int64_t beg, int64_t end){
+	return bcf_itr_queryi(idx, tid, beg, end);
+}
+
+hts_itr_t *ibcf_itr_querys(hts_idx_t *idx, bcf_hdr_t *hdr, char *s){
+	return bcf_itr_querys(idx, hdr, s);
+}
+
+int ibcf_itr_next(htsFile *fp, hts_itr_t *iter, bcf1_t *b){
+	return bcf_itr_next(fp, iter, b);
+}
+
+const char **ibcf_index_seqnames(hts_idx_t *idx, bcf_hdr_t *hdr, int *n){
+	return bcf_index_seqnames(idx, hdr, n);
+}
+
+int hdr_ncontigs(bcf_hdr_t *h) {
+	return h->n[BCF_DT_CTG];
+}
+
+int hdr_nids(bcf_hdr_t *h) {
+	return h->n[BCF_DT_ID] + h->n[BCF_DT_CTG];
+}
+
+const char *hdr_contig_name(bcf_hdr_t *h, int i) {
+	return h->id[BCF_DT_CTG][i].key;
+}
+
+int64_t hdr_contig_len(bcf_hdr_t *h, int i) {
+	return h->id[BCF_DT_CTG][i].val->info[0];
+}
+
+// hdr_dup is bcf_hdr_dup that also keeps the samples selected by
+// bcf_hdr_set_samples.
+bcf_hdr_t *hdr_dup(bcf_hdr_t *h) {
+	bcf_hdr_t *out = bcf_hdr_dup(h);
+	if (out != NULL && h->keep_samples != NULL) {
+		size_t n = (h->nsamples_ori + 7) / 8;
+		out->keep_samples = malloc(n);
+		memcpy(out->keep_samples, h->keep_samples, n);
+		out->nsamples_ori = h->nsamples_ori;
+	}
+	return out;
+}
+
 inline int atbx_itr_next(htsFile *fp, tbx_t *tbx, hts_itr_t *iter, kstring_t *data) {
 	return tbx_itr_next(fp, tbx, iter, (void *)data);
 }
 
+// csi_params reads min_shift and depth from the header of a .csi index.
+int csi_params(const char *fn, int *min_shift, int *depth) {
+	BGZF *fp = bgzf_open(fn, "r");
+	if (fp == NULL) return -1;
+	char magic[4];
+	int32_t v[2];
+	int ret = 0;
+	if (bgzf_read(fp, magic, 4) != 4 || memcmp(magic, "CSI\1", 4) != 0 || bgzf_read(fp, v, 8) != 8) {
+		ret = -1;
+	} else {
+		*min_shift = v[0];
+		*depth = v[1];
+	}
+	bgzf_close(fp);
+	return ret;
+}
+
 char *allele_i(bcf1_t *b, int idx) {
 	return b->d.allele[idx];
 }
@@ -78,34 +141,93 @@ float ivf(bcf_info_t *i) {
 
 
 int ibcf_update_info_int32(const bcf_hdr_t *hdr, bcf1_t * line, const char *key, const int32_t *values, int n) {
-	bcf_update_info((hdr),(line),(key),(values),(n),BCF_HT_INT);
+	return bcf_update_info((hdr),(line),(key),(values),(n),BCF_HT_INT);
 }
 
 int ibcf_update_info_float(const bcf_hdr_t *hdr, bcf1_t * line, const char *key, const float *values, int n){
-	bcf_update_info((hdr),(line),(key),(values),(n),BCF_HT_REAL);
+	return bcf_update_info((hdr),(line),(key),(values),(n),BCF_HT_REAL);
 }
 int ibcf_update_info_flag(const bcf_hdr_t *hdr, bcf1_t * line, const char *key, const char *string, int n){
-	bcf_update_info((hdr),(line),(key),(string),(n),BCF_HT_FLAG);
+	return bcf_update_info((hdr),(line),(key),(string),(n),BCF_HT_FLAG);
 }
 int ibcf_update_info_string(const bcf_hdr_t *hdr, bcf1_t * line, const char *key, const char *string){
-	bcf_update_info((hdr),(line),(key),(string),1,BCF_HT_STR);
+	return bcf_update_info((hdr),(line),(key),(string),1,BCF_HT_STR);
 }
 
 int ibcf_hdr_id2type(bcf_hdr_t *hdr, int htype, int tag_id){
 	return bcf_hdr_id2type(hdr, htype, tag_id);
 }
 
+int ibcf_hdr_id2length(bcf_hdr_t *hdr, int htype, int tag_id){
+	return bcf_hdr_id2length(hdr, htype, tag_id);
+}
+
+int ibcf_hdr_id2number(bcf_hdr_t *hdr, int htype, int tag_id){
+	return bcf_hdr_id2number(hdr, htype, tag_id);
+}
+
+float missing_float(void) {
+	float f;
+	bcf_float_set_missing(f);
+	return f;
+}
+
 char *vid(bcf1_t *b) {
 	return b->d.id;
 }
 
+int n_allele(bcf1_t *b) {
+	return b->n_allele;
+}
+
+void qual_set_missing(bcf1_t *b) {
+	bcf_float_set_missing(b->qual);
+}
+
+int n_flt(bcf1_t *b) {
+	return b->d.n_flt;
+}
+
+int flt_i(bcf1_t *b, int i) {
+	return b->d.flt[i];
+}
+
+char *hdr_int2id(bcf_hdr_t *hdr, int id) {
+	return (char *)bcf_hdr_int2id(hdr, BCF_DT_ID, id);
+}
+
+int ibcf_hdr_idinfo_exists(bcf_hdr_t *hdr, int htype, int tag_id);
+
+int n_info(bcf1_t *b) {
+	return b->n_info;
+}
+
+bcf_info_t *info_i(bcf1_t *b, int i) {
+	return &b->d.info[i];
+}
+
+// hrec_attr returns an attribute like Type or Number from the header line of
+// tag_id or NULL.
+char *hrec_attr(bcf_hdr_t *hdr, int hl, int tag_id, char *attr) {
+	bcf_hrec_t *rec = bcf_hdr_id2hrec(hdr, BCF_DT_ID, hl, tag_id);
+	if (rec == NULL) return NULL;
+	int i = bcf_hrec_find_key(rec, attr);
+	if (i < 0) return NULL;
+	return rec->vals[i];
+}
+
 */
 import "C"
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/brentp/irelate/interfaces"
@@ -118,6 +240,8 @@ type FileType string
 const (
 	BED   FileType = "bed"
 	VCF   FileType = "vcf"
+	BCF   FileType = "bcf"
+	GFF   FileType = "gff"
 	OTHER FileType = "other"
 )
 
@@ -128,80 +252,656 @@ const BCF_BT_INT32 int = 3
 const BCF_BT_FLOAT int = 5
 const BCF_BT_CHAR int = 7
 
+// min_shift and depth of the fixed binning scheme used by .tbi indexes.
+const (
+	tbiMinShift = 14
+	tbiDepth    = 5
+)
+
 type Tabix struct {
-	path            string
-	tbx             *C.tbx_t
-	htf             *C.htsFile
-	hdr             *C.bcf_hdr_t
-	itr             *C.hts_itr_t
-	typ             FileType
-	original_header bool
+	path     string
+	index    string
+	minShift int
+	depth    int
+	tbx      *C.tbx_t
+	idx      *C.hts_idx_t
+	htf      *C.htsFile
+	hdr      *C.bcf_hdr_t
+	itr      *C.hts_itr_t
+	typ      FileType
+	// header owns hdr. Adding a header line replaces both.
+	header *vcfHeader
+	// subset is true when only some samples are parsed.
+	subset bool
+	// autoDeclare is Options.AutoDeclareInfo and declared the INFO keys it
+	// has added to the header.
+	autoDeclare bool
+	declared    []string
+	// headerWritten is set by the first Writer to write the header, after
+	// which no lines can be added.
+	headerWritten bool
+
+	// mu guards the files and index, which are freed by Close. Reads hold it
+	// for reading so that queries can run concurrently, each on its own
+	// htsFile from idle.
+	mu     sync.RWMutex
+	closed bool
+	poolMu sync.Mutex
+	idle   []*C.htsFile
+	// parseIdle are the parse headers of finished queries.
+	parseIdle []*parseHeader
 }
 
+// parseHeader is a private copy of a version of the header for vcf_parse,
+// which adds lines for undeclared contigs and tags to the header it is given.
+type parseHeader struct {
+	hdr  *C.bcf_hdr_t
+	from *vcfHeader
+}
+
+// ErrClosed is returned when a Tabix, Fasta or BamReader is used after Close.
+var ErrClosed = errors.New("cgotabix: use of closed file")
+
+// ErrHeaderWritten is returned by INFO.Set when it would declare a key after
+// a Writer has written the header of the Tabix.
+var ErrHeaderWritten = errors.New("cgotabix: header already written by a Writer")
+
 func tabixCloser(t *Tabix) {
+	t.Close()
+}
+
+// vcfHeader owns a bcf_hdr_t. Headers are never changed once Variants may
+// point to them: adding a line, or vcf_parse meeting an undeclared contig or
+// tag, makes a new version and each Variant keeps the version it was read
+// with alive until it is translated or collected.
+type vcfHeader struct {
+	hdr     *C.bcf_hdr_t
+	version int
+}
+
+func newVCFHeader(hdr *C.bcf_hdr_t, version int) *vcfHeader {
+	h := &vcfHeader{hdr: hdr, version: version}
+	runtime.SetFinalizer(h, func(h *vcfHeader) { C.bcf_hdr_destroy(h.hdr) })
+	return h
+}
+
+// Close closes the files and frees the index. It waits for records being
+// read; iteration still in progress then stops and later queries return
+// ErrClosed. The VCF header is still used by the Variants already returned so
+// it is freed once they are collected. Calling Close more than once is a no-op.
+func (t *Tabix) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
 	if t.tbx != nil {
 		C.tbx_destroy(t.tbx)
+		t.tbx = nil
 	}
-	if t.htf != nil {
-		C.hts_close(t.htf)
+	if t.idx != nil {
+		C.hts_idx_destroy(t.idx)
+		t.idx = nil
 	}
-	if t.hdr != nil {
-		C.bcf_hdr_destroy(t.hdr)
+	t.htf = nil
+	t.poolMu.Lock()
+	defer t.poolMu.Unlock()
+	var err error
+	for _, htf := range t.idle {
+		if C.hts_close(htf) != 0 {
+			err = fmt.Errorf("cgotabix: error closing %s", t.path)
+		}
+	}
+	t.idle = nil
+	for _, p := range t.parseIdle {
+		C.bcf_hdr_destroy(p.hdr)
+	}
+	t.parseIdle = nil
+	return err
+}
+
+// acquire returns an idle file handle, opening a new one if all are in use.
+func (t *Tabix) acquire() (*C.htsFile, error) {
+	t.poolMu.Lock()
+	if n := len(t.idle); n > 0 {
+		htf := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.poolMu.Unlock()
+		return htf, nil
+	}
+	t.poolMu.Unlock()
+	cs := C.CString(t.path)
+	defer C.free(unsafe.Pointer(cs))
+	mode := C.CString("r")
+	defer C.free(unsafe.Pointer(mode))
+	htf := C.hts_open(cs, mode)
+	if htf == nil {
+		return nil, fmt.Errorf("unable to open %s", t.path)
+	}
+	return htf, nil
+}
+
+// release returns htf to the pool or closes it if t has been closed.
+func (t *Tabix) release(htf *C.htsFile) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		C.hts_close(htf)
+		return
 	}
+	t.poolMu.Lock()
+	t.idle = append(t.idle, htf)
+	t.poolMu.Unlock()
 }
 
-// New takes a path to a bgziped (and tabixed file) and returns the tabix struct.
+// New takes a path to a bgziped (and tabixed file) or an indexed .bcf and
+// returns the tabix struct. The index is loaded from path+".tbi" or, if that
+// does not exist, path+".csi". The file type is detected from the contents of
+// the file and its index.
 func New(path string) (*Tabix, error) {
-	if !(xopen.Exists(path) && xopen.Exists(path+".tbi")) {
-		return nil, fmt.Errorf("need gz file and .tbi for %s", path)
+	return NewWithOptions(path, Options{})
+}
+
+// Options configures NewWithOptions. The zero value detects everything.
+type Options struct {
+	// Type of the file. If empty, BCF and VCF are detected from the content of
+	// the file and BED and GFF from the columns stored in the index.
+	Type FileType
+	// IndexPath is the .tbi or .csi index. If empty, path+".tbi" and then
+	// path+".csi" are used.
+	IndexPath string
+	// Preset, if not nil, replaces the columns stored in a tabix index.
+	Preset *Preset
+	// HeaderPath, if set, is a VCF or BCF whose header is used instead of the
+	// header of the file itself, e.g. for headerless chunks of a VCF.
+	HeaderPath string
+	// Samples, if not nil, limits the samples parsed from a VCF or BCF to
+	// these names. An empty, non-nil slice parses no samples at all.
+	Samples []string
+	// ExcludeSamples makes Samples the list of samples to leave out.
+	ExcludeSamples bool
+	// AutoDeclareInfo makes INFO.Set add an ##INFO line for a key that is
+	// not in the header, with the Type and Number inferred from the value.
+	// Once a Writer has written the header, Set returns ErrHeaderWritten
+	// instead, so keys that only some records get should be declared with
+	// AddInfoToHeader up front. See AutoDeclared.
+	AutoDeclareInfo bool
+}
+
+// NewWithOptions opens path as described by opts.
+func NewWithOptions(path string, opts Options) (*Tabix, error) {
+	index := opts.IndexPath
+	if index == "" {
+		index = findIndex(path)
+	}
+	if !xopen.Exists(path) || index == "" || !xopen.Exists(index) {
+		return nil, fmt.Errorf("need gz file and .tbi or .csi for %s", path)
 	}
 
-	t := &Tabix{path: path}
+	t := &Tabix{path: path, index: index, minShift: tbiMinShift, depth: tbiDepth}
 	cs := C.CString(t.path)
 	defer C.free(unsafe.Pointer(cs))
-	mode := C.char('r')
-	t.htf = C.hts_open(cs, &mode)
-	t.tbx = C.tbx_index_load(cs)
+	ci := C.CString(t.index)
+	defer C.free(unsafe.Pointer(ci))
+	mode := C.CString("r")
+	defer C.free(unsafe.Pointer(mode))
+	t.htf = C.hts_open(cs, mode)
 	runtime.SetFinalizer(t, tabixCloser)
-	if strings.HasSuffix(path, ".bed.gz") {
-		t.typ = BED
-	} else if strings.HasSuffix(path, ".vcf.gz") {
-		t.hdr = C.bcf_hdr_read(t.htf)
-		t.typ = VCF
+	if t.htf == nil {
+		return nil, fmt.Errorf("unable to open %s", path)
+	}
+	// the first handle reads the header and then serves queries.
+	t.idle = append(t.idle, t.htf)
+
+	t.typ = opts.Type
+	if t.typ == "" {
+		switch C.hts_get_format(t.htf).format {
+		case C.bcf:
+			t.typ = BCF
+		case C.vcf:
+			t.typ = VCF
+		}
+	}
+	var idx *C.hts_idx_t
+	if t.typ == BCF {
+		t.idx = C.hts_idx_load2(cs, ci)
+		idx = t.idx
 	} else {
-		t.typ = OTHER
+		t.tbx = C.tbx_index_load2(cs, ci)
+		if t.tbx != nil {
+			idx = t.tbx.idx
+		}
 	}
-	t.original_header = true
+	if idx == nil {
+		return nil, fmt.Errorf("unable to load index %s for %s", index, path)
+	}
+	if C.hts_idx_fmt(idx) == C.HTS_FMT_CSI {
+		var minShift, depth C.int
+		if C.csi_params(ci, &minShift, &depth) != 0 {
+			return nil, fmt.Errorf("unable to read csi header from %s", index)
+		}
+		t.minShift, t.depth = int(minShift), int(depth)
+	}
+	if t.tbx != nil && opts.Preset != nil {
+		t.tbx.conf = opts.Preset.conf()
+	}
+	if t.typ == "" {
+		t.typ = typeFromPreset(presetFromConf(t.tbx.conf))
+	}
+
+	if t.typ == VCF || t.typ == BCF {
+		if err := t.readHeader(opts.HeaderPath); err != nil {
+			return nil, err
+		}
+		if opts.Samples != nil {
+			if err := t.setSamples(opts.Samples, opts.ExcludeSamples); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t.autoDeclare = opts.AutoDeclareInfo
 	return t, nil
 }
 
-func (t *Tabix) AddInfoToHeader(id string, number string, vtype string, description string) {
-	if t.original_header {
-		hdr := C.bcf_hdr_dup(t.hdr)
-		C.bcf_hdr_destroy(t.hdr)
-		t.hdr = hdr
+// typeFromPreset guesses the FileType from the columns of a tabix index.
+func typeFromPreset(p Preset) FileType {
+	switch {
+	case p.Format&0xffff == TBX_VCF:
+		return VCF
+	case p == PresetBED:
+		return BED
+	case p == PresetGFF:
+		return GFF
+	}
+	return OTHER
+}
+
+// setSamples makes the header parse only the given samples, or all but the
+// given samples if exclude is true.
+func (t *Tabix) setSamples(samples []string, exclude bool) error {
+	if len(samples) == 0 && exclude {
+		return nil
+	}
+	var list *C.char
+	if len(samples) > 0 {
+		for _, s := range samples {
+			if strings.ContainsRune(s, ',') {
+				return fmt.Errorf("can't select sample with comma: %s", s)
+			}
+		}
+		l := strings.Join(samples, ",")
+		if exclude {
+			l = "^" + l
+		}
+		list = C.CString(l)
+		defer C.free(unsafe.Pointer(list))
+	}
+	ret := C.bcf_hdr_set_samples(t.hdr, list, 0)
+	if ret < 0 {
+		return fmt.Errorf("error selecting samples from %s", t.path)
+	}
+	if ret > 0 {
+		return fmt.Errorf("sample %s not found in %s", samples[ret-1], t.path)
+	}
+	t.subset = true
+	return nil
+}
+
+// readHeader reads the VCF header from the file itself or, if headerPath is
+// set, from that file.
+func (t *Tabix) readHeader(headerPath string) error {
+	if headerPath == "" {
+		t.hdr = C.bcf_hdr_read(t.htf)
+	} else {
+		cs := C.CString(headerPath)
+		defer C.free(unsafe.Pointer(cs))
+		mode := C.CString("r")
+		defer C.free(unsafe.Pointer(mode))
+		htf := C.hts_open(cs, mode)
+		if htf == nil {
+			return fmt.Errorf("unable to open header file %s", headerPath)
+		}
+		t.hdr = C.bcf_hdr_read(htf)
+		C.hts_close(htf)
+	}
+	if t.hdr == nil {
+		return fmt.Errorf("unable to read VCF header for %s", t.path)
+	}
+	t.header = newVCFHeader(t.hdr, 0)
+	return nil
+}
+
+// findIndex returns the path of the .tbi or .csi index for path or "" if
+// neither exists.
+func findIndex(path string) string {
+	for _, ext := range []string{".tbi", ".csi"} {
+		if xopen.Exists(path + ext) {
+			return path + ext
+		}
+	}
+	return ""
+}
+
+// checkOpen returns ErrClosed if t has been closed.
+func (t *Tabix) checkOpen() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Type returns the FileType of the records returned by Get and At.
+func (t *Tabix) Type() FileType {
+	return t.typ
+}
+
+// Chroms returns the names of the sequences with records in the index.
+func (t *Tabix) Chroms() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return []string{}
+	}
+	var n C.int
+	var names **C.char
+	if t.typ == BCF {
+		names = C.ibcf_index_seqnames(t.idx, t.hdr, &n)
+	} else {
+		names = C.tbx_seqnames(t.tbx, &n)
+	}
+	if names == nil {
+		return []string{}
+	}
+	chroms := make([]string, int(n))
+	slice := (*[1 << 28]*C.char)(unsafe.Pointer(names))[:n:n]
+	for i, name := range slice {
+		chroms[i] = C.GoString(name)
+	}
+	C.free(unsafe.Pointer(names))
+	return chroms
+}
+
+// Contig is a ##contig line from a VCF header. Length is 0 when the line has
+// no length.
+type Contig struct {
+	Name   string
+	Length int
+}
+
+// Contigs returns the ##contig lines of the header of a VCF or BCF in header
+// order. It returns nil for other file types.
+func (t *Tabix) Contigs() []Contig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.hdr == nil {
+		return nil
+	}
+	n := int(C.hdr_ncontigs(t.hdr))
+	contigs := make([]Contig, n)
+	for i := 0; i < n; i++ {
+		contigs[i] = Contig{
+			Name:   C.GoString(C.hdr_contig_name(t.hdr, C.int(i))),
+			Length: int(C.hdr_contig_len(t.hdr, C.int(i))),
+		}
+	}
+	return contigs
+}
+
+// IndexPath returns the path of the .tbi or .csi index in use.
+func (t *Tabix) IndexPath() string {
+	return t.index
+}
+
+// MinShift returns the size of the smallest bin of the index as a power of 2.
+// It is 14 for .tbi indexes.
+func (t *Tabix) MinShift() int {
+	return t.minShift
+}
+
+// Depth returns the number of levels of the binning index. It is 5 for .tbi
+// indexes, which limits them to contigs of 2^29 bases.
+func (t *Tabix) Depth() int {
+	return t.depth
+}
+
+// HeaderError is returned when a line can't be added to a VCF header.
+type HeaderError struct {
+	Line   string
+	Reason string
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("cgotabix: can't add %s to header: %s", e.Line, e.Reason)
+}
+
+var (
+	headerIDRe     = regexp.MustCompile(`^([A-Za-z_][0-9A-Za-z_.]*|1000G)$`)
+	headerNumberRe = regexp.MustCompile(`^([0-9]+|A|R|G|\.)$`)
+	contigIDRe     = regexp.MustCompile(`^[0-9A-Za-z!#$%&+./:;?@^_|~-][0-9A-Za-z!#$%&*+./:;=?@^_|~-]*$`)
+)
+
+// AddInfoToHeader adds an ##INFO line so that the key can be used with
+// INFO.Set. vtype is one of Integer, Float, Flag, Character or String and
+// number is an integer, A, R, G or "."; a Flag must have number 0.
+func (t *Tabix) AddInfoToHeader(id string, number string, vtype string, description string) error {
+	line := fmt.Sprintf("##INFO=<ID=%s,Number=%s,Type=%s,Description=\"%s\">", id, number, vtype, escapeDescription(description))
+	if reason := checkField(id, number, vtype, true); reason != "" {
+		return &HeaderError{Line: line, Reason: reason}
+	}
+	return t.addHeaderLine(line, fieldDefined(C.BCF_HL_INFO, id, number, vtype))
+}
+
+// AutoDeclared returns the INFO keys added to the header by INFO.Set because
+// of Options.AutoDeclareInfo, in the order they were added.
+func (t *Tabix) AutoDeclared() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]string(nil), t.declared...)
+}
+
+// declareInfo adds an ##INFO line for an automatically declared key unless
+// another record has already declared it.
+func (t *Tabix) declareInfo(id, number, vtype string) error {
+	line := fmt.Sprintf("##INFO=<ID=%s,Number=%s,Type=%s,Description=\"Added by cgotabix\">", id, number, vtype)
+	if reason := checkField(id, number, vtype, true); reason != "" {
+		return &HeaderError{Line: line, Reason: reason}
+	}
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hdr != nil {
+		if n := C.bcf_hdr_id2int(t.hdr, C.BCF_DT_ID, cid); n >= 0 && C.ibcf_hdr_idinfo_exists(t.hdr, C.BCF_HL_INFO, n) != 0 {
+			return nil
+		}
+	}
+	if t.headerWritten {
+		return ErrHeaderWritten
+	}
+	if err := t.appendHeaderLine(line); err != nil {
+		return err
+	}
+	t.declared = append(t.declared, id)
+	return nil
+}
 
+// AddFormatToHeader adds a ##FORMAT line. The arguments are as for
+// AddInfoToHeader except that Flag is not allowed.
+func (t *Tabix) AddFormatToHeader(id string, number string, vtype string, description string) error {
+	line := fmt.Sprintf("##FORMAT=<ID=%s,Number=%s,Type=%s,Description=\"%s\">", id, number, vtype, escapeDescription(description))
+	if reason := checkField(id, number, vtype, false); reason != "" {
+		return &HeaderError{Line: line, Reason: reason}
 	}
-	ckey := C.CString(fmt.Sprintf("##INFO=<ID=%s,Number=%s,Type=%s,Description=\"%s\"", id, number, vtype, description))
-	e := C.bcf_hdr_append(t.hdr, ckey)
+	return t.addHeaderLine(line, fieldDefined(C.BCF_HL_FMT, id, number, vtype))
+}
+
+// AddFilterToHeader adds a ##FILTER line.
+func (t *Tabix) AddFilterToHeader(id string, description string) error {
+	line := fmt.Sprintf("##FILTER=<ID=%s,Description=\"%s\">", id, escapeDescription(description))
+	if !headerIDRe.MatchString(id) {
+		return &HeaderError{Line: line, Reason: "invalid ID"}
+	}
+	return t.addHeaderLine(line, fieldDefined(C.BCF_HL_FLT, id, "", ""))
+}
+
+// AddContigToHeader adds a ##contig line. A length of 0 is left out.
+func (t *Tabix) AddContigToHeader(id string, length int) error {
+	line := fmt.Sprintf("##contig=<ID=%s>", id)
+	if length > 0 {
+		line = fmt.Sprintf("##contig=<ID=%s,length=%d>", id, length)
+	}
+	if !contigIDRe.MatchString(id) {
+		return &HeaderError{Line: line, Reason: "invalid ID"}
+	}
+	if length < 0 {
+		return &HeaderError{Line: line, Reason: "negative length"}
+	}
+	return t.addHeaderLine(line, contigDefined(id, length))
+}
+
+// checkField returns why an INFO or FORMAT definition is invalid or "".
+func checkField(id, number, vtype string, info bool) string {
+	if !headerIDRe.MatchString(id) {
+		return "invalid ID"
+	}
+	if !headerNumberRe.MatchString(number) {
+		return "Number must be an integer, A, R, G or ."
+	}
+	switch vtype {
+	case "Integer", "Float", "Character", "String":
+	case "Flag":
+		if !info {
+			return "Flag is only allowed in INFO"
+		}
+		if number != "0" {
+			return "Flag must have Number=0"
+		}
+	default:
+		return "Type must be Integer, Float, Flag, Character or String"
+	}
+	return ""
+}
+
+func escapeDescription(d string) string {
+	d = strings.Replace(d, "\\", "\\\\", -1)
+	d = strings.Replace(d, "\"", "\\\"", -1)
+	return strings.Replace(d, "\n", " ", -1)
+}
+
+// definedFunc reports whether the ID of a header line is already defined
+// and, if so, why the existing definition conflicts with the line or "".
+type definedFunc func(hdr *C.bcf_hdr_t) (defined bool, conflict string)
+
+// fieldDefined checks for an INFO, FORMAT or FILTER line with the same ID.
+// INFO and FORMAT lines must also have the same Number and Type.
+func fieldDefined(hl C.int, id, number, vtype string) definedFunc {
+	return func(hdr *C.bcf_hdr_t) (bool, string) {
+		cid := C.CString(id)
+		defer C.free(unsafe.Pointer(cid))
+		n := C.bcf_hdr_id2int(hdr, C.BCF_DT_ID, cid)
+		if n < 0 || C.ibcf_hdr_idinfo_exists(hdr, hl, n) == 0 {
+			return false, ""
+		}
+		if hl == C.BCF_HL_FLT {
+			return true, ""
+		}
+		cnumber, ctype := C.CString("Number"), C.CString("Type")
+		defer C.free(unsafe.Pointer(cnumber))
+		defer C.free(unsafe.Pointer(ctype))
+		hnumber := C.GoString(C.hrec_attr(hdr, hl, n, cnumber))
+		htype := C.GoString(C.hrec_attr(hdr, hl, n, ctype))
+		if hnumber != number || htype != vtype {
+			return true, fmt.Sprintf("%s is already defined with Number=%s,Type=%s", id, hnumber, htype)
+		}
+		return true, ""
+	}
+}
+
+// contigDefined checks for a contig with the same ID and, if both are
+// given, the same length.
+func contigDefined(id string, length int) definedFunc {
+	return func(hdr *C.bcf_hdr_t) (bool, string) {
+		cid := C.CString(id)
+		defer C.free(unsafe.Pointer(cid))
+		n := C.bcf_hdr_name2id(hdr, cid)
+		if n < 0 {
+			return false, ""
+		}
+		if l := int(C.hdr_contig_len(hdr, n)); l > 0 && length > 0 && l != length {
+			return true, fmt.Sprintf("%s is already defined with length=%d", id, l)
+		}
+		return true, ""
+	}
+}
+
+// addHeaderLine makes a new version of the header with line appended. The
+// Variants already read keep the old version; see Variant.Translate. If
+// defined finds the ID of line in the header, line is skipped when it agrees
+// with the existing definition and a HeaderError is returned otherwise, as
+// htslib would silently keep the existing one.
+func (t *Tabix) addHeaderLine(line string, defined definedFunc) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	if t.hdr != nil {
+		if ok, conflict := defined(t.hdr); ok {
+			if conflict != "" {
+				return &HeaderError{Line: line, Reason: conflict}
+			}
+			return nil
+		}
+	}
+	return t.appendHeaderLine(line)
+}
+
+// appendHeaderLine adds line to a new version of the header. mu must be held.
+func (t *Tabix) appendHeaderLine(line string) error {
+	if t.closed {
+		return ErrClosed
+	}
+	if t.hdr == nil {
+		return &HeaderError{Line: line, Reason: "not a VCF"}
+	}
+	if t.headerWritten {
+		return &HeaderError{Line: line, Reason: "the header has already been written by a Writer"}
+	}
+	hdr := C.hdr_dup(t.hdr)
+	ckey := C.CString(line)
+	e := C.bcf_hdr_append(hdr, ckey)
 	C.free(unsafe.Pointer(ckey))
 	if e != 0 {
-		log.Fatalf("couldn't add to header\n")
+		C.bcf_hdr_destroy(hdr)
+		return &HeaderError{Line: line, Reason: "bcf_hdr_append failed"}
 	}
-	if C.bcf_hdr_sync(t.hdr) != 0 {
-		log.Fatalf("error syncing header\n")
+	if C.bcf_hdr_sync(hdr) != 0 {
+		C.bcf_hdr_destroy(hdr)
+		return &HeaderError{Line: line, Reason: "bcf_hdr_sync failed"}
 	}
+	t.header = newVCFHeader(hdr, t.header.version+1)
+	t.hdr = hdr
+	return nil
 }
 
 type INFO struct {
-	hdr *C.bcf_hdr_t
-	b   *C.bcf1_t
+	*recordHeader
+	b *C.bcf1_t
+	// t, when set, is the Tabix that Set declares new keys in.
+	t *Tabix
 }
 
+// Get returns the value of key: an int, float64 or string for single values,
+// []int, []float32 or string for lists, true for a set flag and nil if key is
+// absent or a single missing value. Missing elements of a list are MissingInt
+// or NaN.
 func (i *INFO) Get(key string) (interface{}, error) {
 	ckey := C.CString(key)
 	info := C.bcf_get_info(i.hdr, i.b, ckey)
-	if info == nil {
+	if info == nil || info.vptr == nil {
 		// return nil for bool (false)
 		C.free(unsafe.Pointer(ckey))
 		return nil, nil
@@ -217,119 +917,154 @@ func (i *INFO) Delete(key string) {
 	C.free(unsafe.Pointer(ckey))
 }
 
-func (i *INFO) Set(key string, ovalue interface{}) error {
+// Set sets key, which must be declared in the header unless the Tabix was
+// opened with AutoDeclareInfo and no Writer has written its header, to value. value is converted to the declared
+// Type: Integer accepts Go integers and integer slices, Float also accepts
+// float32/float64 and their slices (NaN is written as missing), String and
+// Character accept string and []string and Flag accepts bool. The number of
+// values must match a Number of A, R, G (assuming diploid) or a fixed integer.
+func (i *INFO) Set(key string, value interface{}) error {
 	ckey := C.CString(key)
-	var ret C.int
+	defer C.free(unsafe.Pointer(ckey))
+	id := C.bcf_hdr_id2int(i.hdr, C.BCF_DT_ID, ckey)
+	if id < 0 || C.ibcf_hdr_idinfo_exists(i.hdr, C.BCF_HL_INFO, id) == 0 {
+		if i.t == nil || !i.t.autoDeclare {
+			return &InfoError{Key: key, Err: ErrNotDefined}
+		}
+		if err := i.declare(key, value); err != nil {
+			return err
+		}
+		id = C.bcf_hdr_id2int(i.hdr, C.BCF_DT_ID, ckey)
+	}
 
-	switch ovalue.(type) {
-	case int:
-		value := C.int32_t(ovalue.(int))
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, &value, 1)
-	case float32:
-		value := C.float(ovalue.(float32))
-		ret = C.ibcf_update_info_float(i.hdr, i.b, ckey, &value, 1)
-	case float64:
-		value := C.float(ovalue.(float64))
-		ret = C.ibcf_update_info_float(i.hdr, i.b, ckey, &value, 1)
-	case string:
-		value := C.CString(ovalue.(string))
-		ret = C.ibcf_update_info_string(i.hdr, i.b, ckey, value)
-		C.free(unsafe.Pointer(value))
-	case bool:
-		value := ovalue.(bool)
-
-		if value {
-			ret = C.ibcf_update_info_flag(i.hdr, i.b, ckey, ckey, 1)
-		} else {
-			ret = C.ibcf_update_info_flag(i.hdr, i.b, ckey, ckey, 0)
-		}
-	case []uint32:
-		value := ovalue.([]uint32)
-		l := len(value)
-		val := make([]int32, l)
-		for i, v := range value {
-			val[i] = int32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(ptr), C.int(l))
-
-	case []int:
-		value := ovalue.([]int)
-		l := len(value)
-		val := make([]int32, l)
-		for i, v := range value {
-			val[i] = int32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(ptr), C.int(l))
-
-	case []uint64:
-		value := ovalue.([]uint64)
-		l := len(value)
-		val := make([]int32, l)
-		for i, v := range value {
-			val[i] = int32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(ptr), C.int(l))
-
-	case []int32:
-		value := ovalue.([]int32)
-		l := len(value)
-		val := make([]int32, l)
-		for i, v := range value {
-			val[i] = int32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(ptr), C.int(l))
-
-	case []int64:
-		value := ovalue.([]int64)
-		l := len(value)
-		val := make([]int32, l)
-		for i, v := range value {
-			val[i] = int32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(ptr), C.int(l))
-
-	case []float64:
-		value := ovalue.([]float32)
-		l := len(value)
-		val := make([]float32, l)
-		for i, v := range value {
-			val[i] = float32(v)
-		}
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_float(i.hdr, i.b, ckey, (*C.float)(ptr), C.int(l))
-
-	case []float32:
-		val := ovalue.([]float32)
-		l := len(val)
-		ptr := unsafe.Pointer(&val[0])
-		ret = C.ibcf_update_info_float(i.hdr, i.b, ckey, (*C.float)(ptr), C.int(l))
-
-	case []string:
-		valuestr := ovalue.([]string)
-		value := C.CString(strings.Join(valuestr, ","))
-		ret = C.ibcf_update_info_string(i.hdr, i.b, ckey, value)
-		C.free(unsafe.Pointer(value))
-	case []bool:
-		// not possible
+	var ret C.int
+	switch C.ibcf_hdr_id2type(i.hdr, C.BCF_HL_INFO, id) {
+	case C.BCF_HT_FLAG:
+		set, ok := value.(bool)
+		if !ok {
+			return &InfoError{Key: key, Err: fmt.Errorf("%w: %T for Flag", ErrWrongType, value)}
+		}
+		n := C.int(0)
+		if set {
+			n = 1
+		}
+		ret = C.ibcf_update_info_flag(i.hdr, i.b, ckey, ckey, n)
+	case C.BCF_HT_INT:
+		vals, err := toInt32s(value)
+		if err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		if err := i.checkNumber(id, len(vals)); err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		ret = C.ibcf_update_info_int32(i.hdr, i.b, ckey, (*C.int32_t)(unsafe.Pointer(&vals[0])), C.int(len(vals)))
+	case C.BCF_HT_REAL:
+		vals, err := toFloat32s(value)
+		if err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		if err := i.checkNumber(id, len(vals)); err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		cvals := make([]C.float, len(vals))
+		for k, v := range vals {
+			if math.IsNaN(float64(v)) {
+				cvals[k] = C.missing_float()
+			} else {
+				cvals[k] = C.float(v)
+			}
+		}
+		ret = C.ibcf_update_info_float(i.hdr, i.b, ckey, &cvals[0], C.int(len(cvals)))
 	default:
-		log.Printf("multipe values for type: %T; not implemented (key: %s)\n", ovalue, key)
-
+		vals, err := toStrings(value)
+		if err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		if err := i.checkNumber(id, len(vals)); err != nil {
+			return &InfoError{Key: key, Err: err}
+		}
+		cs := C.CString(strings.Join(vals, ","))
+		ret = C.ibcf_update_info_string(i.hdr, i.b, ckey, cs)
+		C.free(unsafe.Pointer(cs))
 	}
-	var e error
 	if ret != 0 {
-		e = fmt.Errorf("not set %s %v of type %T\n", key, ovalue, ovalue)
+		return &InfoError{Key: key, Err: fmt.Errorf("bcf_update_info failed for %v", value)}
 	}
-	C.free(unsafe.Pointer(ckey))
-	return e
+	return nil
+}
+
+// checkNumber returns an error if n values don't match the Number of the
+// INFO field id.
+func (i *INFO) checkNumber(id C.int, n int) error {
+	nal := int(C.n_allele(i.b))
+	want, number := -1, ""
+	switch C.ibcf_hdr_id2length(i.hdr, C.BCF_HL_INFO, id) {
+	case C.BCF_VL_FIXED:
+		want = int(C.ibcf_hdr_id2number(i.hdr, C.BCF_HL_INFO, id))
+		number = fmt.Sprintf("%d", want)
+	case C.BCF_VL_A:
+		want, number = nal-1, "A"
+	case C.BCF_VL_R:
+		want, number = nal, "R"
+	case C.BCF_VL_G:
+		want, number = nal*(nal+1)/2, "G"
+	}
+	if n == 0 || (want >= 0 && n != want) {
+		return fmt.Errorf("%w: got %d for Number=%s", ErrWrongNumber, n, number)
+	}
+	return nil
 }
 
+// Keys returns the keys of the INFO column in file order.
 func (i *INFO) Keys() []string {
-	return []string{}
+	n := int(C.n_info(i.b))
+	keys := make([]string, 0, n)
+	for k := 0; k < n; k++ {
+		info := C.info_i(i.b, C.int(k))
+		if info.vptr == nil {
+			continue
+		}
+		keys = append(keys, C.GoString(C.hdr_int2id(i.hdr, info.key)))
+	}
+	return keys
+}
+
+// InfoField is one entry of the INFO column of a record.
+type InfoField struct {
+	Key string
+	// Type and Number are as declared in the header, e.g. "Integer" and "A".
+	Type   string
+	Number string
+	// Value is as returned by Get; true for flags. Missing ('.') elements of
+	// a list are MissingInt or NaN.
+	Value interface{}
+}
+
+// Each calls fn with each entry of the INFO column in file order until fn
+// returns false.
+func (i *INFO) Each(fn func(InfoField) bool) {
+	ctype := C.CString("Type")
+	defer C.free(unsafe.Pointer(ctype))
+	cnumber := C.CString("Number")
+	defer C.free(unsafe.Pointer(cnumber))
+
+	n := int(C.n_info(i.b))
+	for k := 0; k < n; k++ {
+		info := C.info_i(i.b, C.int(k))
+		if info.vptr == nil {
+			continue
+		}
+		key := C.hdr_int2id(i.hdr, info.key)
+		f := InfoField{
+			Key:    C.GoString(key),
+			Type:   C.GoString(C.hrec_attr(i.hdr, C.BCF_HL_INFO, info.key, ctype)),
+			Number: C.GoString(C.hrec_attr(i.hdr, C.BCF_HL_INFO, info.key, cnumber)),
+			Value:  i.get(info, key),
+		}
+		if !fn(f) {
+			return
+		}
+	}
 }
 
 func (i *INFO) String() string {
@@ -350,6 +1085,10 @@ func (i *INFO) Bytes() []byte {
 
 func (self *INFO) get(info *C.bcf_info_t, tag *C.char) interface{} {
 	ctype := C.itype(info)
+	// flags are stored without a value.
+	if int(ctype) == BCF_BT_NULL {
+		return true
+	}
 	if info.len == 1 {
 		switch ctype {
 		case C.BCF_BT_INT8, C.BCF_BT_INT16, C.BCF_BT_INT32:
@@ -394,10 +1133,10 @@ func (self *INFO) get(info *C.bcf_info_t, tag *C.char) interface{} {
 		out := make([]int, l)
 		slice := (*[1 << 20]C.int8_t)(unsafe.Pointer(info.vptr))[:l:l]
 		for i := 0; i < l; i++ {
-			//if slice[i] == C.bcf_int8_missing
-			//		out[i] = nil
 			if slice[i] == C.bcf_int8_vector_end {
 				return out[:i]
+			} else if slice[i] == C.bcf_int8_missing {
+				out[i] = MissingInt
 			} else {
 				out[i] = int(slice[i])
 			}
@@ -409,10 +1148,10 @@ func (self *INFO) get(info *C.bcf_info_t, tag *C.char) interface{} {
 		out := make([]int, l)
 		slice := (*[1 << 20]C.int16_t)(unsafe.Pointer(info.vptr))[:l:l]
 		for i := 0; i < l; i++ {
-			//if slice[i] == C.bcf_int16_missing
-			//		out[i] = nil
 			if slice[i] == C.bcf_int16_vector_end {
 				return out[:i]
+			} else if slice[i] == C.bcf_int16_missing {
+				out[i] = MissingInt
 			} else {
 				out[i] = int(slice[i])
 			}
@@ -424,10 +1163,10 @@ func (self *INFO) get(info *C.bcf_info_t, tag *C.char) interface{} {
 		out := make([]int, l)
 		slice := (*[1 << 20]C.int32_t)(unsafe.Pointer(info.vptr))[:l:l]
 		for i := 0; i < l; i++ {
-			//if slice[i] == C.bcf_int32_missing
-			//		out[i] = nil
 			if slice[i] == C.bcf_int32_vector_end {
 				return out[:i]
+			} else if slice[i] == C.bcf_int32_missing {
+				out[i] = MissingInt
 			} else {
 				out[i] = int(slice[i])
 			}
@@ -441,6 +1180,8 @@ func (self *INFO) get(info *C.bcf_info_t, tag *C.char) interface{} {
 		for i := 0; i < l; i++ {
 			if C.bcf_float_is_vector_end(slice[i]) != 0 {
 				return out[:i]
+			} else if C.bcf_float_is_missing(slice[i]) != 0 {
+				out[i] = float32(math.NaN())
 			} else {
 				out[i] = float32(slice[i])
 			}
@@ -461,6 +1202,9 @@ func _string(info *C.bcf_info_t, hdr *C.bcf_hdr_t, tag *C.char) interface{} {
 	}
 
 	// https://github.com/golang/go/wiki/cgo
+	if l == 0 {
+		return ""
+	}
 	slice := (*[1 << 20]uint8)(unsafe.Pointer(s))[:l:l]
 	if slice[0] == 0x7 {
 		return nil
@@ -468,9 +1212,26 @@ func _string(info *C.bcf_info_t, hdr *C.bcf_hdr_t, tag *C.char) interface{} {
 	return string(slice)
 }
 
+// newVariant wraps a record read from t with the header it was read with.
+func (t *Tabix) newVariant(b *C.bcf1_t, header *vcfHeader) *Variant {
+	v := NewVariant(b, header.hdr, 1)
+	v.header = header
+	v.Info_.(*INFO).t = t
+	return v
+}
+
+// recordHeader is the header of a record. It is shared by a Variant and its
+// INFO, rather than the INFO pointing back to the Variant, so that both see
+// a translation and the Variant can still be finalized.
+type recordHeader struct {
+	hdr *C.bcf_hdr_t
+	// header, if set, owns hdr and keeps it alive.
+	header *vcfHeader
+}
+
 type Variant struct {
-	v       *C.bcf1_t
-	hdr     *C.bcf_hdr_t
+	v *C.bcf1_t
+	*recordHeader
 	source  uint32
 	Info_   interfaces.Info
 	related []interfaces.Relatable
@@ -480,9 +1241,10 @@ type Variant struct {
 
 func NewVariant(v *C.bcf1_t, hdr *C.bcf_hdr_t, source uint32) *Variant {
 	C.bcf_unpack(v, 1|2|4) // dont unpack genotypes
-	c := &Variant{v: v, hdr: hdr, source: 1}
+	rh := &recordHeader{hdr: hdr}
+	c := &Variant{v: v, recordHeader: rh, source: 1}
 	c.Pos = uint64(v.pos + 1)
-	c.Info_ = &INFO{hdr, v}
+	c.Info_ = &INFO{recordHeader: rh, b: v}
 	runtime.SetFinalizer(c, variantFinalizer)
 	return c
 }
@@ -507,38 +1269,88 @@ func (c *Variant) Start() uint32 {
 	return uint32(c.v.pos)
 }
 
+// End is the 0-based, half-open end of the reference allele, from END if it
+// is set. For symbolic alleles such as <DEL> without END it is taken from
+// SVLEN.
 func (c *Variant) End() uint32 {
-	return uint32(c.v.pos + c.v.rlen)
+	end := uint32(c.v.pos + c.v.rlen)
+	if e, ok := c.svEnd(); ok && e > end {
+		return e
+	}
+	return end
 }
 
-func (c *Variant) CIPos() (uint32, uint32, bool) {
+// CIPos returns the interval of possible start positions given by CIPOS. If
+// CIPOS is not set it is the start base and ok is false.
+func (c *Variant) CIPos() (start, end uint32, ok bool) {
 	s := c.Start()
-	ipair, err := c.Info_.Get("CIPOS")
-	if ipair == nil || err != nil {
-		return s, s + 1, false
-	}
-	pair, ok := ipair.([]interface{})
+	left, right, ok := c.confidence("CIPOS")
 	if !ok {
 		return s, s + 1, false
 	}
-	left := pair[0].(int)
-	right := pair[0].(int)
-	return uint32(int(s) + left), uint32(int(s) + right + 1), true
+	return offset(s, left), offset(s, right+1), true
 }
 
-func (c *Variant) CIEnd() (uint32, uint32, bool) {
+// CIEnd returns the interval of possible end positions given by CIEND. If
+// CIEND is not set it is the last base and ok is false.
+func (c *Variant) CIEnd() (start, end uint32, ok bool) {
 	e := c.End()
-	ipair, err := c.Info_.Get("CIEnd")
-	if ipair == nil || err != nil {
+	left, right, ok := c.confidence("CIEND")
+	if !ok {
 		return e - 1, e, false
 	}
-	pair, ok := ipair.([]interface{})
+	return offset(e-1, left), offset(e, right), true
+}
+
+// confidence returns the bounds of a CIPOS or CIEND field.
+func (c *Variant) confidence(key string) (left, right int, ok bool) {
+	info, ok := c.Info_.(*INFO)
 	if !ok {
-		return e - 1, e, false
+		return 0, 0, false
+	}
+	pair, set, err := info.GetInts(key)
+	if err != nil || len(pair) != 2 || !set[0] || !set[1] {
+		return 0, 0, false
+	}
+	return pair[0], pair[1], true
+}
+
+func offset(pos uint32, d int) uint32 {
+	if d < 0 && uint32(-d) > pos {
+		return 0
 	}
-	left := pair[0].(int)
-	right := pair[0].(int)
-	return uint32(int(e) + left), uint32(int(e) + right + 1), true
+	return uint32(int64(pos) + int64(d))
+}
+
+// Translate moves c to the current header of t so that it can use the lines
+// added with AddInfoToHeader and friends since it was read. c must have been
+// read from t.
+func (c *Variant) Translate(t *Tabix) error {
+	return c.translate(t, c.v)
+}
+
+// translate moves b to the current header of t.
+func (h *recordHeader) translate(t *Tabix, b *C.bcf1_t) error {
+	// bcf_translate caches its mapping in the source header so it must not
+	// run concurrently.
+	t.mu.Lock()
+	header := t.header
+	if header == nil {
+		t.mu.Unlock()
+		return fmt.Errorf("cgotabix: %s has no VCF header", t.path)
+	}
+	if header == h.header {
+		t.mu.Unlock()
+		return nil
+	}
+	ret := C.bcf_translate(header.hdr, h.hdr, b)
+	t.mu.Unlock()
+	if ret != 0 {
+		return fmt.Errorf("cgotabix: unable to translate %s:%d to the header of %s",
+			C.GoString(C.bcf_hdr_id2name(h.hdr, C.int(b.rid))), int(b.pos)+1, t.path)
+	}
+	h.header, h.hdr = header, header.hdr
+	return nil
 }
 
 func (c *Variant) Source() uint32 {
@@ -566,8 +1378,9 @@ func (c *Variant) AddRelated(i interfaces.Relatable) {
 
 func (c *Variant) Alt() []string {
 	if c._alt == nil {
-		c._alt = make([]string, c.v.n_allele-1)
-		for i := 1; i < int(c.v.n_allele); i++ {
+		n := int(C.n_allele(c.v))
+		c._alt = make([]string, n-1)
+		for i := 1; i < n; i++ {
 			c._alt[i-1] = C.GoString(C.allele_i(c.v, C.int(i)))
 		}
 	}
@@ -578,85 +1391,563 @@ func (c *Variant) Ref() string {
 	return C.GoString(C.allele_i(c.v, 0))
 }
 
+// SetRef replaces the reference allele. End changes with it unless the record
+// has an END.
+func (c *Variant) SetRef(ref string) error {
+	return c.setAlleles(ref, c.Alt())
+}
+
+// SetAlt replaces the alternate alleles.
+func (c *Variant) SetAlt(alt []string) error {
+	return c.setAlleles(c.Ref(), alt)
+}
+
+func (c *Variant) setAlleles(ref string, alt []string) error {
+	if ref == "" {
+		return fmt.Errorf("empty REF allele")
+	}
+	alleles := append([]string{ref}, alt...)
+	for _, a := range alleles {
+		if a == "" || strings.ContainsAny(a, ",\t") {
+			return fmt.Errorf("invalid allele %q", a)
+		}
+	}
+	cs := C.CString(strings.Join(alleles, ","))
+	defer C.free(unsafe.Pointer(cs))
+	if C.bcf_update_alleles_str(c.hdr, c.v, cs) != 0 {
+		return fmt.Errorf("error setting alleles %v", alleles)
+	}
+	c._alt = nil
+	return nil
+}
+
+// SetId sets the ID column. An empty id is written as ".".
+func (c *Variant) SetId(id string) error {
+	var cs *C.char
+	if id != "" && id != "." {
+		cs = C.CString(id)
+		defer C.free(unsafe.Pointer(cs))
+	}
+	if C.bcf_update_id(c.hdr, c.v, cs) != 0 {
+		return fmt.Errorf("error setting id %s", id)
+	}
+	return nil
+}
+
+// SetPos sets the 1-based position, the same as the Pos field.
+func (c *Variant) SetPos(pos uint64) error {
+	if pos < 1 {
+		return fmt.Errorf("position must be >= 1")
+	}
+	c.v.pos = C.hts_pos_t(pos - 1)
+	c.Pos = pos
+	return nil
+}
+
+// Qual returns the QUAL column and false if it is missing.
+func (c *Variant) Qual() (float32, bool) {
+	if C.bcf_float_is_missing(c.v.qual) != 0 {
+		return 0, false
+	}
+	return float32(c.v.qual), true
+}
+
+// SetQual sets the QUAL column.
+func (c *Variant) SetQual(q float32) {
+	c.v.qual = C.float(q)
+}
+
+// SetQualMissing sets the QUAL column to ".".
+func (c *Variant) SetQualMissing() {
+	C.qual_set_missing(c.v)
+}
+
+// Filters returns the FILTER column. It is empty for ".".
+func (c *Variant) Filters() []string {
+	n := int(C.n_flt(c.v))
+	filters := make([]string, n)
+	for i := 0; i < n; i++ {
+		filters[i] = C.GoString(C.hdr_int2id(c.hdr, C.flt_i(c.v, C.int(i))))
+	}
+	return filters
+}
+
+// SetFilters replaces the FILTER column. Each filter must be defined in the
+// header, see AddFilterToHeader. No filters sets the column to ".".
+func (c *Variant) SetFilters(filters ...string) error {
+	ids := make([]C.int, len(filters))
+	for i, f := range filters {
+		id, err := c.filterId(f)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	var ptr *C.int
+	if len(ids) > 0 {
+		ptr = &ids[0]
+	}
+	if C.bcf_update_filter(c.hdr, c.v, ptr, C.int(len(ids))) != 0 {
+		return fmt.Errorf("error setting filters %v", filters)
+	}
+	return nil
+}
+
+// AddFilter adds a filter to the FILTER column. Adding any filter other than
+// PASS removes PASS.
+func (c *Variant) AddFilter(filter string) error {
+	id, err := c.filterId(filter)
+	if err != nil {
+		return err
+	}
+	if C.bcf_add_filter(c.hdr, c.v, id) != 0 {
+		return fmt.Errorf("error adding filter %s", filter)
+	}
+	return nil
+}
+
+// HasFilter reports whether filter is in the FILTER column. As in htslib, a
+// FILTER of "." counts as PASS.
+func (c *Variant) HasFilter(filter string) bool {
+	cs := C.CString(filter)
+	defer C.free(unsafe.Pointer(cs))
+	return C.bcf_has_filter(c.hdr, c.v, cs) == 1
+}
+
+// IsPass is true when the FILTER column is PASS or ".".
+func (c *Variant) IsPass() bool {
+	return c.HasFilter("PASS")
+}
+
+func (c *Variant) filterId(filter string) (C.int, error) {
+	cs := C.CString(filter)
+	defer C.free(unsafe.Pointer(cs))
+	id := C.bcf_hdr_id2int(c.hdr, C.BCF_DT_ID, cs)
+	if id < 0 || C.ibcf_hdr_idinfo_exists(c.hdr, C.BCF_HL_FLT, id) == 0 {
+		return 0, fmt.Errorf("FILTER/%s is not defined in the header", filter)
+	}
+	return id, nil
+}
+
+// Relate sends the records that overlap each position read from in. The
+// caller must drain the returned channel; use RelateContext to stop early.
+// Errors other than ErrClosed are logged.
 func (t *Tabix) Relate(in chan interfaces.IPosition) chan []interfaces.IPosition {
+	out, errc := t.RelateContext(context.Background(), in)
+	go func() { logDropped(t.path, <-errc) }()
+	return out
+}
+
+// RelateContext is like Relate but stops when ctx is done. The returned
+// channel is closed when in is closed, ctx is done or the Tabix is closed,
+// after which the error channel yields the reason: nil, ctx.Err() or
+// ErrClosed.
+func (t *Tabix) RelateContext(ctx context.Context, in chan interfaces.IPosition) (chan []interfaces.IPosition, <-chan error) {
 	out := make(chan []interfaces.IPosition, 0)
+	errc := make(chan error, 1)
 	go func() {
-		for iv := range in {
-			out <- t.Get(iv)
+		var err error
+		defer func() {
+			close(out)
+			errc <- err
+			close(errc)
+		}()
+		for {
+			var iv interfaces.IPosition
+			var ok bool
+			select {
+			case iv, ok = <-in:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+			if !ok {
+				return
+			}
+			var overlaps []interfaces.IPosition
+			if overlaps, err = t.Query(iv); err != nil {
+				return
+			}
+			select {
+			case out <- overlaps:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
 		}
-		close(out)
 	}()
-	return out
+	return out, errc
 }
 
+// Get returns the records that overlap q. It returns no records after Close.
+// Other errors, such as a record that can't be parsed, are logged and the
+// records read before them are returned; use Query to handle them.
 func (t *Tabix) Get(q interfaces.IPosition) []interfaces.IPosition {
-	//cs := C.CString(fmt.Sprintf("%s:%d-%d", q.Chrom(), q.Start()+1, q.End()))
-	ch := C.CString(q.Chrom())
-	cs := C.tbx_name2id(t.tbx, ch)
+	overlaps, err := t.Query(q)
+	logDropped(t.path, err)
+	return overlaps
+}
 
-	itr := C.tabix_itr_queryi(t.tbx, cs, C.int(q.Start()), C.int(q.End()))
+// logDropped logs an error that Get, At or Relate can't return. ErrClosed is
+// not logged as those document that they stop after Close.
+func logDropped(path string, err error) {
+	if err != nil && err != ErrClosed {
+		log.Printf("error reading %s:%s\n", path, err)
+	}
+}
 
-	kstr := C.kstring_t{}
+// Query returns the records that overlap q or ErrClosed after Close.
+func (t *Tabix) Query(q interfaces.IPosition) ([]interfaces.IPosition, error) {
 	overlaps := make([]interfaces.IPosition, 0, 4)
-	l := C.int(10)
-	for l > 0 {
-		l := C.atbx_itr_next(t.htf, t.tbx, itr, &kstr)
-		if l < 0 {
+	itr, err := t.queryi(q.Chrom(), q.Start(), q.End())
+	if err != nil {
+		return overlaps, err
+	}
+
+	cur, err := t.newCursor(itr)
+	if err != nil {
+		return overlaps, err
+	}
+	var r interfaces.Relatable
+	for {
+		r, err = t.next(cur)
+		if r == nil {
 			break
 		}
-		//res := C.GoString(kstr.s)
-		if t.typ == VCF {
-			b := C.bcf_init()
-			ret := C.vcf_parse(&kstr, t.hdr, b)
-			if ret < 0 {
-				log.Printf("error parsing %s\n", C.GoStringN(kstr.s, C.int(kstr.l)))
+		overlaps = append(overlaps, r)
+	}
+	t.free(cur)
+	return overlaps, err
+}
+
+// At takes a region like 1:45678-56789 and returns a channel on which
+// it sends a Relatable for each record that falls in that interval.
+// The channel is closed early if the Tabix is closed or on an error, which
+// is logged. The caller must drain the channel; use AtContext to stop early
+// or to handle errors.
+func (t *Tabix) At(region string) interfaces.RelatableChannel {
+	out, errc := t.AtContext(context.Background(), region)
+	go func() { logDropped(t.path, <-errc) }()
+	return out
+}
+
+// AtContext is like At but stops when ctx is done, freeing the query and
+// closing the channel. Once the channel is closed the error channel yields
+// the reason iteration ended: nil at the end of the region, ctx.Err() or
+// ErrClosed.
+func (t *Tabix) AtContext(ctx context.Context, region string) (interfaces.RelatableChannel, <-chan error) {
+	out := make(interfaces.RelatableChannel, 20)
+	errc := make(chan error, 1)
+	itr, err := t.querys(region)
+	var cur *cursor
+	if err == nil {
+		cur, err = t.newCursor(itr)
+	}
+	if err != nil {
+		close(out)
+		errc <- err
+		close(errc)
+		return out, errc
+	}
+
+	go func() {
+		var err error
+		defer func() {
+			t.free(cur)
+			close(out)
+			errc <- err
+			close(errc)
+		}()
+		for {
+			if err = ctx.Err(); err != nil {
+				return
 			}
-			overlaps = append(overlaps, NewVariant(b, t.hdr, 1))
-		} else if t.typ == BED {
+			var r interfaces.Relatable
+			if r, err = t.next(cur); r == nil {
+				return
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// cursor is a query in progress, reading from its own file handle.
+type cursor struct {
+	itr  *C.hts_itr_t
+	htf  *C.htsFile
+	kstr C.kstring_t
+	// parse is the header VCF lines are parsed with.
+	parse *parseHeader
+}
+
+// newCursor takes a handle from the pool to read itr, which may be nil for
+// an empty result.
+func (t *Tabix) newCursor(itr *C.hts_itr_t) (*cursor, error) {
+	cur := &cursor{itr: itr}
+	if itr == nil {
+		return cur, nil
+	}
+	htf, err := t.acquire()
+	if err != nil {
+		C.hts_itr_destroy(itr)
+		return nil, err
+	}
+	cur.htf = htf
+	return cur, nil
+}
+
+// free destroys the iterator and returns the handle to the pool.
+func (t *Tabix) free(cur *cursor) {
+	if cur.itr != nil {
+		C.hts_itr_destroy(cur.itr)
+		cur.itr = nil
+	}
+	if cur.htf != nil {
+		t.release(cur.htf)
+		cur.htf = nil
+	}
+	if cur.parse != nil {
+		t.releaseParse(cur.parse)
+		cur.parse = nil
+	}
+	C.free(unsafe.Pointer(cur.kstr.s))
+	cur.kstr = C.kstring_t{}
+}
+
+// queryi returns an iterator over chrom:start-end or nil if chrom is not in
+// the index.
+func (t *Tabix) queryi(chrom string, start, end uint32) (*C.hts_itr_t, error) {
+	ch := C.CString(chrom)
+	defer C.free(unsafe.Pointer(ch))
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	if t.typ == BCF {
+		tid := C.bcf_hdr_name2id(t.hdr, ch)
+		if tid < 0 {
+			return nil, nil
+		}
+		return C.ibcf_itr_queryi(t.idx, tid, C.int64_t(start), C.int64_t(end)), nil
+	}
+	tid := C.tbx_name2id(t.tbx, ch)
+	if tid < 0 {
+		return nil, nil
+	}
+	return C.tabix_itr_queryi(t.tbx, tid, C.int64_t(start), C.int64_t(end)), nil
+}
+
+// querys returns an iterator over a region like 1:45678-56789, nil if its
+// chromosome is not in the index or an error if it can't be parsed.
+func (t *Tabix) querys(region string) (*C.hts_itr_t, error) {
+	cs := C.CString(region)
+	defer C.free(unsafe.Pointer(cs))
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	var itr *C.hts_itr_t
+	if t.typ == BCF {
+		itr = C.ibcf_itr_querys(t.idx, t.hdr, cs)
+	} else {
+		itr = C.tabix_itr_querys(t.tbx, cs)
+	}
+	if itr != nil {
+		return itr, nil
+	}
+	chrom := region
+	if i := strings.LastIndexByte(region, ':'); i >= 0 && !t.hasChrom(region) {
+		chrom = region[:i]
+	}
+	if !t.hasChrom(chrom) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cgotabix: invalid region %q for %s", region, t.path)
+}
+
+// hasChrom reports whether chrom is known to the index. mu must be held.
+func (t *Tabix) hasChrom(chrom string) bool {
+	cs := C.CString(chrom)
+	defer C.free(unsafe.Pointer(cs))
+	if t.typ == BCF {
+		return C.bcf_hdr_name2id(t.hdr, cs) >= 0
+	}
+	return C.tbx_name2id(t.tbx, cs) >= 0
+}
+
+// next returns the next record from cur or nil when it is exhausted.
+// BCF records are read directly into a bcf1_t; text records are read into
+// cur.kstr and parsed according to the file type. It returns nil and an
+// error if the file can't be read or a VCF line can't be parsed, and
+// ErrClosed once the Tabix is closed.
+func (t *Tabix) next(cur *cursor) (interfaces.Relatable, error) {
+	if cur.itr == nil {
+		return nil, nil
+	}
+	if t.typ == VCF {
+		return t.nextVCF(cur)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	itr, kstr := cur.itr, &cur.kstr
+	if t.typ == BCF {
+		b := C.bcf_init()
+		if ret := C.ibcf_itr_next(cur.htf, itr, b); ret < 0 {
+			C.bcf_destroy(b)
+			return nil, t.readError(ret)
+		}
+		// unlike vcf_parse, BCF reading leaves sample subsetting to us.
+		if t.subset {
+			C.bcf_subset_format(t.hdr, b)
+		}
+		return t.newVariant(b, t.header), nil
+	}
+	for {
+		l := C.atbx_itr_next(cur.htf, t.tbx, itr, kstr)
+		if l < 0 {
+			return nil, t.readError(l)
+		}
+		switch t.typ {
+		case BED:
 			iv, err := parsers.IntervalFromBedLine(C.GoBytes(unsafe.Pointer(kstr.s), C.int(kstr.l)))
 			if err != nil {
 				log.Printf("error parsing %s:%s\n", C.GoStringN(kstr.s, C.int(kstr.l)), err)
 			}
 			if iv != nil {
-				overlaps = append(overlaps, iv)
+				return iv, nil
+			}
+		case GFF:
+			f, err := NewFeature(C.GoStringN(kstr.s, C.int(kstr.l)))
+			if err != nil {
+				log.Printf("error parsing %s:%s\n", C.GoStringN(kstr.s, C.int(kstr.l)), err)
+				continue
 			}
+			return f, nil
+		default:
+			r, err := NewRecord(C.GoStringN(kstr.s, C.int(kstr.l)), presetFromConf(t.tbx.conf))
+			if err != nil {
+				log.Printf("error parsing %s:%s\n", C.GoStringN(kstr.s, C.int(kstr.l)), err)
+				continue
+			}
+			return r, nil
 		}
+	}
+}
 
+// readError returns the error for a return value ret < 0 of an htslib read:
+// nil for -1, the end of the data, and an error for anything less.
+func (t *Tabix) readError(ret C.int) error {
+	if ret == -1 {
+		return nil
 	}
-	C.hts_itr_destroy(itr)
-	C.free(unsafe.Pointer(ch))
-	C.free(unsafe.Pointer(kstr.s))
-	return overlaps
+	return fmt.Errorf("cgotabix: error reading %s (%d)", t.path, int(ret))
 }
 
-// At takes a region like 1:45678-56789 and returns a channel on which
-// it sends a string for each line that falls in that interval.
-func (t *Tabix) At(region string) interfaces.RelatableChannel {
-	cs := C.CString(region)
-	defer C.free(unsafe.Pointer(cs))
+// nextVCF reads the next line of cur and parses it. Unlike next it can't hold
+// mu while parsing as parseVCF may need to replace the header.
+func (t *Tabix) nextVCF(cur *cursor) (interfaces.Relatable, error) {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	l := C.atbx_itr_next(cur.htf, t.tbx, cur.itr, &cur.kstr)
+	t.mu.RUnlock()
+	if l < 0 {
+		return nil, t.readError(l)
+	}
+	return t.parseVCF(cur)
+}
 
-	out := make(interfaces.RelatableChannel, 20)
-	itr := C.tabix_itr_querys(t.tbx, cs)
+// parseVCF parses the line in cur with a private copy of the current header
+// so that queries can parse concurrently. If vcf_parse added lines to the
+// copy they go into a new version of the header, as Variants may be using the
+// current one.
+func (t *Tabix) parseVCF(cur *cursor) (interfaces.Relatable, error) {
+	for {
+		t.mu.RLock()
+		header := t.header
+		if cur.parse == nil {
+			cur.parse = t.acquireParse(header)
+		} else if cur.parse.from != header {
+			C.bcf_hdr_destroy(cur.parse.hdr)
+			cur.parse = &parseHeader{hdr: C.hdr_dup(header.hdr), from: header}
+		}
+		t.mu.RUnlock()
+
+		p := cur.parse
+		n := C.hdr_nids(p.hdr)
+		b := C.bcf_init()
+		if C.vcf_parse(&cur.kstr, p.hdr, b) < 0 {
+			C.bcf_destroy(b)
+			return nil, fmt.Errorf("cgotabix: error parsing %s in %s", C.GoStringN(cur.kstr.s, C.int(cur.kstr.l)), t.path)
+		}
+		if C.hdr_nids(p.hdr) == n {
+			return t.newVariant(b, p.from), nil
+		}
 
-	go func() {
-		kstr := C.kstring_t{}
-		l := C.int(10)
-		for l > 0 {
-			l := C.atbx_itr_next(t.htf, t.tbx, itr, &kstr)
-			if l < 0 {
-				break
-			}
-			//res := C.GoString(kstr.s)
-			b := C.bcf_init()
-			ret := C.vcf_parse(&kstr, t.hdr, b)
-			if ret < 0 {
-				log.Printf("error parsing %s\n", C.GoStringN(kstr.s, C.int(kstr.l)))
+		// p now differs from the version it was copied from.
+		t.mu.Lock()
+		if t.header != p.from || t.headerWritten {
+			written := t.headerWritten
+			t.mu.Unlock()
+			C.bcf_destroy(b)
+			C.bcf_hdr_destroy(p.hdr)
+			cur.parse = nil
+			if written {
+				return nil, fmt.Errorf("%w: can't add the undeclared contigs or tags of %s in %s",
+					ErrHeaderWritten, C.GoStringN(cur.kstr.s, C.int(cur.kstr.l)), t.path)
 			}
-			out <- NewVariant(b, t.hdr, 1)
+			// the header changed while parsing; parse again with the new one.
+			continue
 		}
-		close(out)
-		C.hts_itr_destroy(itr)
-		C.free(unsafe.Pointer(kstr.s))
-	}()
-	return out
+		t.header = newVCFHeader(C.hdr_dup(p.hdr), p.from.version+1)
+		t.hdr = t.header.hdr
+		p.from = t.header
+		t.mu.Unlock()
+		return t.newVariant(b, p.from), nil
+	}
+}
+
+// acquireParse returns an idle parse header for header, copying header if
+// there is none. mu must be held for reading.
+func (t *Tabix) acquireParse(header *vcfHeader) *parseHeader {
+	t.poolMu.Lock()
+	var p *parseHeader
+	if n := len(t.parseIdle); n > 0 {
+		p = t.parseIdle[n-1]
+		t.parseIdle = t.parseIdle[:n-1]
+	}
+	t.poolMu.Unlock()
+	if p != nil && p.from == header {
+		return p
+	}
+	if p != nil {
+		C.bcf_hdr_destroy(p.hdr)
+	}
+	return &parseHeader{hdr: C.hdr_dup(header.hdr), from: header}
+}
+
+// releaseParse returns p to the pool or frees it if t has been closed.
+func (t *Tabix) releaseParse(p *parseHeader) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		C.bcf_hdr_destroy(p.hdr)
+		return
+	}
+	t.poolMu.Lock()
+	t.parseIdle = append(t.parseIdle, p)
+	t.poolMu.Unlock()
 }
@@ -1,8 +1,17 @@
 package cgotabix
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/brentp/irelate/interfaces"
 	. "gopkg.in/check.v1"
 )
 
@@ -59,3 +68,306 @@ func (s *TSuite) TestEmptyRegion(c *C) {
 	c.Assert(i, Equals, 0)
 
 }
+
+func (s *TSuite) TestIndexParams(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.IndexPath(), Equals, "vt.norm.vcf.gz.tbi")
+	c.Assert(t.MinShift(), Equals, 14)
+	c.Assert(t.Depth(), Equals, 5)
+}
+
+func (s *TSuite) TestIndexParamsCSI(c *C) {
+	path := copyVCF(c, c.MkDir())
+	c.Assert(BuildIndexCSI(path, PresetVCF, 12), IsNil)
+	_, err := os.Stat(path + ".tbi")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	defer t.Close()
+	c.Assert(t.IndexPath(), Equals, path+".csi")
+	c.Assert(t.MinShift(), Equals, 12)
+	// htslib gives a CSI enough levels to reach 2^31 bases: (31-12+2)/3.
+	c.Assert(t.Depth(), Equals, 7)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+}
+
+func (s *TSuite) TestMissingIndex(c *C) {
+	_, err := New("cgotabix.go")
+	c.Assert(err, NotNil)
+}
+
+func (s *TSuite) TestNewWithOptions(c *C) {
+	dir := c.MkDir()
+	path := copyVCF(c, dir)
+	bgz := filepath.Join(dir, "t.vcf.bgz")
+	c.Assert(os.Rename(path, bgz), IsNil)
+	c.Assert(BuildIndex(bgz, PresetVCF), IsNil)
+	index := filepath.Join(dir, "elsewhere.tbi")
+	c.Assert(os.Rename(bgz+".tbi", index), IsNil)
+
+	_, err := New(bgz)
+	c.Assert(err, NotNil)
+
+	t, err := NewWithOptions(bgz, Options{IndexPath: index})
+	c.Assert(err, IsNil)
+	c.Assert(t.Type(), Equals, VCF)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+
+	t, err = NewWithOptions(bgz, Options{IndexPath: index, Type: OTHER})
+	c.Assert(err, IsNil)
+	c.Assert(t.Type(), Equals, OTHER)
+}
+
+func (s *TSuite) TestChroms(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.Chroms(), DeepEquals, []string{"1"})
+	c.Assert(t.Contigs(), DeepEquals, []Contig{{Name: "1", Length: 0}})
+}
+
+func (s *TSuite) TestClose(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	vs := t.Get(Position{"1", 50000, 90000})
+	c.Assert(t.Close(), IsNil)
+	c.Assert(t.Close(), IsNil)
+
+	_, err = t.Query(Position{"1", 50000, 90000})
+	c.Assert(err, Equals, ErrClosed)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 0)
+	i := 0
+	for _ = range t.At("1:50000-90000") {
+		i += 1
+	}
+	c.Assert(i, Equals, 0)
+	_, err = t.Header()
+	c.Assert(err, Equals, ErrClosed)
+	c.Assert(t.Chroms(), HasLen, 0)
+
+	// variants from before Close are still usable.
+	c.Assert(vs[0].Chrom(), Equals, "1")
+}
+
+func (s *TSuite) TestConcurrent(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	// an unfinished At holds its own handle.
+	ch := t.At("1:50000-90000")
+	<-ch
+
+	var wg sync.WaitGroup
+	counts := make([]int, 8)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 20; k++ {
+				for _, r := range t.Get(Position{"1", 50000, 90000}) {
+					if r.(*Variant).Chrom() == "1" {
+						counts[i]++
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, n := range counts {
+		c.Assert(n, Equals, 15*20)
+	}
+	n := 1
+	for range ch {
+		n++
+	}
+	c.Assert(n, Equals, 15)
+	c.Assert(t.Close(), IsNil)
+}
+
+func (s *TSuite) TestAtContext(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	// more records than fit in the channel's buffer.
+	ch, errc := t.AtContext(ctx, "1")
+	<-ch
+	cancel()
+	for range ch {
+	}
+	c.Assert(<-errc, Equals, context.Canceled)
+	// the handle went back to the pool.
+	c.Assert(t.idle, HasLen, 1)
+
+	ch, errc = t.AtContext(context.Background(), "1:50000-90000")
+	n := 0
+	for range ch {
+		n++
+	}
+	c.Assert(n, Equals, 15)
+	c.Assert(<-errc, IsNil)
+
+	c.Assert(t.Close(), IsNil)
+	ch, errc = t.AtContext(context.Background(), "1:50000-90000")
+	_, ok := <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, Equals, ErrClosed)
+}
+
+func (s *TSuite) TestRelateContext(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan interfaces.IPosition)
+	out, errc := t.RelateContext(ctx, in)
+	in <- Position{"1", 50000, 90000}
+	c.Assert(<-out, HasLen, 15)
+	cancel()
+	_, ok := <-out
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, Equals, context.Canceled)
+
+	in = make(chan interfaces.IPosition, 2)
+	in <- Position{"1", 50000, 90000}
+	in <- Position{"1", 54719, 54720}
+	close(in)
+	n := 0
+	for overlaps := range t.Relate(in) {
+		n += len(overlaps)
+	}
+	c.Assert(n, Equals, 16)
+}
+
+func (s *TSuite) TestIterationErrors(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	ch, errc := t.AtContext(context.Background(), "1:100-50")
+	_, ok := <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, NotNil)
+	// an unknown chromosome is just empty.
+	ch, errc = t.AtContext(context.Background(), "2:1-100")
+	_, ok = <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(<-errc, IsNil)
+
+	// a truncated file is an error, not the end of the data.
+	path := filepath.Join(c.MkDir(), "t.bed.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Index: &PresetBED})
+	c.Assert(err, IsNil)
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(w, "chr1\t%d\t%d\n", i*10, i*10+5)
+	}
+	c.Assert(w.Close(), IsNil)
+	fi, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(os.Truncate(path, fi.Size()/2), IsNil)
+	b, err := New(path)
+	c.Assert(err, IsNil)
+	n := 0
+	ch, errc = b.AtContext(context.Background(), "chr1")
+	for range ch {
+		n++
+	}
+	c.Assert(<-errc, NotNil)
+	c.Assert(n > 0 && n < 20000, Equals, true)
+	_, err = b.Query(Position{"chr1", 0, 300000})
+	c.Assert(err, NotNil)
+
+	// Get can't return the error, so it logs it.
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	n = len(b.Get(Position{"chr1", 0, 300000}))
+	c.Assert(n > 0 && n < 20000, Equals, true)
+	c.Assert(strings.Contains(buf.String(), "error reading "+path), Equals, true)
+}
+
+// describe renders the fields of a Variant that a BCF must decode the same
+// way as the VCF it was converted from.
+func describe(c *C, r interfaces.Relatable) string {
+	v := r.(*Variant)
+	q, _ := v.Qual()
+	gts, err := v.Genotypes()
+	c.Assert(err, IsNil)
+	dp, err := v.FormatInts("DP")
+	c.Assert(err, IsNil)
+	gl, err := v.FormatFloats("GL")
+	c.Assert(err, IsNil)
+	return fmt.Sprintf("%s %d %s %v %g %v %v %v", v, v.End(), v.Ref(), v.Alt(), q, gts, dp, gl)
+}
+
+func describeAll(c *C, rs []interfaces.IPosition) []string {
+	ds := make([]string, len(rs))
+	for i, r := range rs {
+		ds[i] = describe(c, r.(interfaces.Relatable))
+	}
+	return ds
+}
+
+// vt.norm.bcf holds the records of vt.norm.vcf.gz with a .csi index.
+func (s *TSuite) TestBCF(c *C) {
+	vcf, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	bcf, err := New("vt.norm.bcf")
+	c.Assert(err, IsNil)
+	c.Assert(bcf.Type(), Equals, BCF)
+	c.Assert(bcf.IndexPath(), Equals, "vt.norm.bcf.csi")
+	c.Assert(bcf.MinShift(), Equals, 14)
+	c.Assert(bcf.Depth(), Equals, 5)
+	c.Assert(bcf.Chroms(), DeepEquals, vcf.Chroms())
+
+	for _, p := range []Position{{"1", 50000, 90000}, {"1", 54719, 54720}, {"1", 0, 1 << 29}, {"2", 0, 100}} {
+		want := vcf.Get(p)
+		got := bcf.Get(p)
+		c.Assert(got, HasLen, len(want), Commentf("%v", p))
+		c.Assert(describeAll(c, got), DeepEquals, describeAll(c, want))
+	}
+	c.Assert(bcf.Get(Position{"1", 0, 1 << 29}), HasLen, 567)
+
+	var want, got []string
+	for r := range vcf.At("1:50000-90000") {
+		want = append(want, describe(c, r))
+	}
+	for r := range bcf.At("1:50000-90000") {
+		got = append(got, describe(c, r))
+	}
+	c.Assert(got, HasLen, 15)
+	c.Assert(got, DeepEquals, want)
+
+	in := make(chan interfaces.IPosition, 2)
+	in <- Position{"1", 50000, 90000}
+	in <- Position{"1", 54719, 54720}
+	close(in)
+	var related [][]string
+	for rs := range bcf.Relate(in) {
+		related = append(related, describeAll(c, rs))
+	}
+	c.Assert(related, DeepEquals, [][]string{
+		describeAll(c, vcf.Get(Position{"1", 50000, 90000})),
+		describeAll(c, vcf.Get(Position{"1", 54719, 54720})),
+	})
+}
+
+func (s *TSuite) TestBCFSamples(c *C) {
+	opts := Options{Samples: []string{"NA06985", "NA06989"}}
+	vcf, err := NewWithOptions("vt.norm.vcf.gz", opts)
+	c.Assert(err, IsNil)
+	bcf, err := NewWithOptions("vt.norm.bcf", opts)
+	c.Assert(err, IsNil)
+	h, err := bcf.Header()
+	c.Assert(err, IsNil)
+	c.Assert(h.Samples, DeepEquals, opts.Samples)
+
+	got := bcf.Get(Position{"1", 50000, 90000})
+	c.Assert(describeAll(c, got), DeepEquals, describeAll(c, vcf.Get(Position{"1", 50000, 90000})))
+	gts, err := bcf.Get(Position{"1", 54719, 54720})[0].(*Variant).Genotypes()
+	c.Assert(err, IsNil)
+	c.Assert(gts, HasLen, 2)
+	c.Assert(gts[0], DeepEquals, Genotype{Alleles: []int{-1, -1}, Phased: true})
+
+	bcf, err = NewWithOptions("vt.norm.bcf", Options{Samples: []string{"NA06984"}, ExcludeSamples: true})
+	c.Assert(err, IsNil)
+	dp, err := bcf.Get(Position{"1", 54719, 54720})[0].(*Variant).FormatInts("DP")
+	c.Assert(err, IsNil)
+	c.Assert(dp, HasLen, 3)
+}
@@ -0,0 +1,107 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/faidx.h"
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Fasta fetches subsequences from a plain or bgzipped FASTA file.
+type Fasta struct {
+	path string
+	fai  *C.faidx_t
+	// mu guards fai against Close. Fetch holds it for writing because fai
+	// reads through a single file handle.
+	mu sync.RWMutex
+}
+
+func fastaCloser(f *Fasta) {
+	if f.fai != nil {
+		C.fai_destroy(f.fai)
+	}
+}
+
+// NewFasta opens the FASTA at path with its .fai (and for bgzipped files,
+// .gzi) index. Missing indexes are built.
+func NewFasta(path string) (*Fasta, error) {
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	f := &Fasta{path: path, fai: C.fai_load(cs)}
+	if f.fai == nil {
+		return nil, fmt.Errorf("unable to load fasta index for %s", path)
+	}
+	runtime.SetFinalizer(f, fastaCloser)
+	return f, nil
+}
+
+// Close frees the index. Calling Close more than once is a no-op.
+func (f *Fasta) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fastaCloser(f)
+	f.fai = nil
+	runtime.SetFinalizer(f, nil)
+	return nil
+}
+
+// Fetch returns the bases of chrom from 0-based start up to, but not
+// including, end; the same coordinates as Variant.Start and End. The result
+// is truncated at the end of the sequence. It returns ErrClosed after Close.
+func (f *Fasta) Fetch(chrom string, start, end uint32) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fai == nil {
+		return "", ErrClosed
+	}
+	if end <= start {
+		return "", fmt.Errorf("invalid interval %s:%d-%d", chrom, start, end)
+	}
+	ch := C.CString(chrom)
+	defer C.free(unsafe.Pointer(ch))
+	var l C.hts_pos_t
+	seq := C.faidx_fetch_seq64(f.fai, ch, C.hts_pos_t(start), C.hts_pos_t(end-1), &l)
+	if seq == nil || l < 0 {
+		if l == -2 {
+			return "", fmt.Errorf("%s not found in %s", chrom, f.path)
+		}
+		return "", fmt.Errorf("error fetching %s:%d-%d from %s", chrom, start, end, f.path)
+	}
+	v := C.GoStringN(seq, C.int(l))
+	C.free(unsafe.Pointer(seq))
+	return v, nil
+}
+
+// Names returns the names of the sequences in file order or nil after Close.
+func (f *Fasta) Names() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.fai == nil {
+		return nil
+	}
+	n := int(C.faidx_nseq(f.fai))
+	names := make([]string, n)
+	for i := 0; i < n; i++ {
+		names[i] = C.GoString(C.faidx_iseq(f.fai, C.int(i)))
+	}
+	return names
+}
+
+// SeqLen returns the length of chrom and false if it is not in the file or
+// f has been closed.
+func (f *Fasta) SeqLen(chrom string) (int, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.fai == nil {
+		return 0, false
+	}
+	ch := C.CString(chrom)
+	defer C.free(unsafe.Pointer(ch))
+	l := int(C.faidx_seq_len(f.fai, ch))
+	return l, l >= 0
+}
@@ -0,0 +1,97 @@
+package cgotabix
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+const testFasta = ">chr1\nACGTACGTAC\nGTACG\n>chr2\nNNNNAAAA\n"
+
+func checkFasta(c *C, path string) {
+	f, err := NewFasta(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	c.Assert(f.Names(), DeepEquals, []string{"chr1", "chr2"})
+	l, ok := f.SeqLen("chr1")
+	c.Assert(ok, Equals, true)
+	c.Assert(l, Equals, 15)
+	_, ok = f.SeqLen("chr3")
+	c.Assert(ok, Equals, false)
+
+	seq, err := f.Fetch("chr1", 8, 12)
+	c.Assert(err, IsNil)
+	c.Assert(seq, Equals, "ACGT")
+	seq, err = f.Fetch("chr2", 4, 100)
+	c.Assert(err, IsNil)
+	c.Assert(seq, Equals, "AAAA")
+	_, err = f.Fetch("chr3", 0, 1)
+	c.Assert(err, NotNil)
+}
+
+func (s *TSuite) TestFasta(c *C) {
+	path := filepath.Join(c.MkDir(), "ref.fa")
+	c.Assert(ioutil.WriteFile(path, []byte(testFasta), 0644), IsNil)
+	checkFasta(c, path)
+}
+
+func (s *TSuite) TestFastaClose(c *C) {
+	path := filepath.Join(c.MkDir(), "ref.fa")
+	c.Assert(ioutil.WriteFile(path, []byte(testFasta), 0644), IsNil)
+	f, err := NewFasta(path)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(f.Close(), IsNil)
+	_, err = f.Fetch("chr1", 0, 4)
+	c.Assert(err, Equals, ErrClosed)
+	c.Assert(f.Names(), IsNil)
+	_, ok := f.SeqLen("chr1")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *TSuite) TestFastaConcurrentClose(c *C) {
+	path := filepath.Join(c.MkDir(), "ref.fa")
+	c.Assert(ioutil.WriteFile(path, []byte(testFasta), 0644), IsNil)
+	f, err := NewFasta(path)
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				seq, err := f.Fetch("chr1", 8, 12)
+				if err == nil && seq != "ACGT" {
+					err = fmt.Errorf("got %q", seq)
+				}
+				if err != nil {
+					if err != ErrClosed {
+						errs[i] = err
+					}
+					return
+				}
+			}
+		}(i)
+	}
+	c.Assert(f.Close(), IsNil)
+	wg.Wait()
+	for _, err := range errs {
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *TSuite) TestFastaBGZF(c *C) {
+	path := filepath.Join(c.MkDir(), "ref.fa.gz")
+	w, err := NewBGZFWriter(path, nil)
+	c.Assert(err, IsNil)
+	_, err = io.WriteString(w, testFasta)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	checkFasta(c, path)
+}
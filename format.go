@@ -0,0 +1,220 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/vcf.h"
+
+int hdr_nsamples(bcf_hdr_t *h);
+int ibcf_hdr_id2type(bcf_hdr_t *hdr, int htype, int tag_id);
+
+int ibcf_hdr_idinfo_exists(bcf_hdr_t *hdr, int htype, int tag_id){
+	return bcf_hdr_idinfo_exists(hdr, htype, tag_id);
+}
+
+int ibcf_get_genotypes(bcf_hdr_t *hdr, bcf1_t *line, int32_t **dst, int *ndst){
+	return bcf_get_genotypes(hdr, line, dst, ndst);
+}
+
+int gt_is_missing(int32_t v) {
+	return bcf_gt_is_missing(v);
+}
+
+int gt_is_phased(int32_t v) {
+	return bcf_gt_is_phased(v);
+}
+
+int gt_allele(int32_t v) {
+	return bcf_gt_allele(v);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// MissingInt is the value of a missing ('.') integer FORMAT value. Missing
+// float values are NaN.
+const MissingInt = math.MinInt32
+
+// Genotype is the GT of one sample. Alleles are indexes into REF and ALT, or
+// -1 for a missing allele.
+type Genotype struct {
+	Alleles []int
+	Phased  bool
+}
+
+// formatError describes the return value of bcf_get_format_*.
+func formatError(key string, ret C.int) error {
+	switch ret {
+	case -1:
+		return fmt.Errorf("FORMAT/%s is not defined in the header", key)
+	case -2:
+		return fmt.Errorf("FORMAT/%s has a different type in the header", key)
+	case -3:
+		return fmt.Errorf("FORMAT/%s is not present in the record", key)
+	}
+	return fmt.Errorf("error reading FORMAT/%s", key)
+}
+
+// Genotypes decodes the GT field of each sample. Sample data is unpacked on
+// the first call so records that are never asked for it don't pay for it.
+func (c *Variant) Genotypes() ([]Genotype, error) {
+	var dst *C.int32_t
+	var ndst C.int
+	n := C.ibcf_get_genotypes(c.hdr, c.v, &dst, &ndst)
+	defer C.free(unsafe.Pointer(dst))
+	if n < 0 {
+		return nil, formatError("GT", n)
+	}
+	nsmpl := int(C.hdr_nsamples(c.hdr))
+	if nsmpl == 0 {
+		return []Genotype{}, nil
+	}
+	ploidy := int(n) / nsmpl
+	slice := (*[1 << 28]C.int32_t)(unsafe.Pointer(dst))[:n:n]
+
+	gts := make([]Genotype, nsmpl)
+	for i := range gts {
+		g := Genotype{Alleles: make([]int, 0, ploidy), Phased: true}
+		for _, a := range slice[i*ploidy : (i+1)*ploidy] {
+			if a == C.bcf_int32_vector_end {
+				break
+			}
+			if C.gt_is_missing(a) != 0 {
+				g.Alleles = append(g.Alleles, -1)
+			} else {
+				g.Alleles = append(g.Alleles, int(C.gt_allele(a)))
+			}
+			// the phase of a genotype is stored on all but its first allele.
+			if len(g.Alleles) > 1 && C.gt_is_phased(a) == 0 {
+				g.Phased = false
+			}
+		}
+		g.Phased = g.Phased && len(g.Alleles) > 1
+		gts[i] = g
+	}
+	return gts, nil
+}
+
+// GetFormat returns the values of a FORMAT field for each sample as [][]int,
+// [][]float32 or []string according to the Type in the header. GT is
+// returned as []Genotype.
+func (c *Variant) GetFormat(key string) (interface{}, error) {
+	if key == "GT" {
+		return c.Genotypes()
+	}
+	ckey := C.CString(key)
+	id := C.bcf_hdr_id2int(c.hdr, C.BCF_DT_ID, ckey)
+	C.free(unsafe.Pointer(ckey))
+	if id < 0 || C.ibcf_hdr_idinfo_exists(c.hdr, C.BCF_HL_FMT, id) == 0 {
+		return nil, formatError(key, -1)
+	}
+	switch C.ibcf_hdr_id2type(c.hdr, C.BCF_HL_FMT, id) {
+	case C.BCF_HT_INT:
+		return c.FormatInts(key)
+	case C.BCF_HT_REAL:
+		return c.FormatFloats(key)
+	default:
+		return c.FormatStrings(key)
+	}
+}
+
+// FormatInts returns the values of an Integer FORMAT field for each sample.
+// Missing values are MissingInt.
+func (c *Variant) FormatInts(key string) ([][]int, error) {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var dst unsafe.Pointer
+	var ndst C.int
+	n := C.bcf_get_format_values(c.hdr, c.v, ckey, &dst, &ndst, C.BCF_HT_INT)
+	defer C.free(dst)
+	if n < 0 {
+		return nil, formatError(key, n)
+	}
+	nsmpl := int(C.hdr_nsamples(c.hdr))
+	out := make([][]int, nsmpl)
+	if nsmpl == 0 {
+		return out, nil
+	}
+	per := int(n) / nsmpl
+	slice := (*[1 << 28]C.int32_t)(dst)[:n:n]
+	for i := range out {
+		vals := make([]int, 0, per)
+		for _, v := range slice[i*per : (i+1)*per] {
+			if v == C.bcf_int32_vector_end {
+				break
+			}
+			if v == C.bcf_int32_missing {
+				vals = append(vals, MissingInt)
+			} else {
+				vals = append(vals, int(v))
+			}
+		}
+		out[i] = vals
+	}
+	return out, nil
+}
+
+// FormatFloats returns the values of a Float FORMAT field for each sample.
+// Missing values are NaN.
+func (c *Variant) FormatFloats(key string) ([][]float32, error) {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var dst unsafe.Pointer
+	var ndst C.int
+	n := C.bcf_get_format_values(c.hdr, c.v, ckey, &dst, &ndst, C.BCF_HT_REAL)
+	defer C.free(dst)
+	if n < 0 {
+		return nil, formatError(key, n)
+	}
+	nsmpl := int(C.hdr_nsamples(c.hdr))
+	out := make([][]float32, nsmpl)
+	if nsmpl == 0 {
+		return out, nil
+	}
+	per := int(n) / nsmpl
+	slice := (*[1 << 28]C.float)(dst)[:n:n]
+	for i := range out {
+		vals := make([]float32, 0, per)
+		for _, v := range slice[i*per : (i+1)*per] {
+			if C.bcf_float_is_vector_end(v) != 0 {
+				break
+			}
+			if C.bcf_float_is_missing(v) != 0 {
+				vals = append(vals, float32(math.NaN()))
+			} else {
+				vals = append(vals, float32(v))
+			}
+		}
+		out[i] = vals
+	}
+	return out, nil
+}
+
+// FormatStrings returns the value of a String or Character FORMAT field for
+// each sample.
+func (c *Variant) FormatStrings(key string) ([]string, error) {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var dst **C.char
+	var ndst C.int
+	n := C.bcf_get_format_string(c.hdr, c.v, ckey, &dst, &ndst)
+	if n < 0 {
+		return nil, formatError(key, n)
+	}
+	nsmpl := int(C.hdr_nsamples(c.hdr))
+	out := make([]string, nsmpl)
+	if nsmpl == 0 {
+		C.free(unsafe.Pointer(dst))
+		return out, nil
+	}
+	slice := (*[1 << 28]*C.char)(unsafe.Pointer(dst))[:nsmpl:nsmpl]
+	for i := range out {
+		out[i] = C.GoString(slice[i])
+	}
+	C.free(unsafe.Pointer(slice[0]))
+	C.free(unsafe.Pointer(dst))
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package cgotabix
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+func firstVariant(c *C) *Variant {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	vs := t.Get(Position{"1", 54719, 54720})
+	c.Assert(len(vs) > 0, Equals, true)
+	return vs[0].(*Variant)
+}
+
+func (s *TSuite) TestGenotypes(c *C) {
+	v := firstVariant(c)
+	gts, err := v.Genotypes()
+	c.Assert(err, IsNil)
+	c.Assert(gts[0], DeepEquals, Genotype{Alleles: []int{0, 0}, Phased: false})
+	c.Assert(gts[1], DeepEquals, Genotype{Alleles: []int{-1, -1}, Phased: true})
+
+	g, err := v.GetFormat("GT")
+	c.Assert(err, IsNil)
+	c.Assert(g, DeepEquals, gts)
+}
+
+func (s *TSuite) TestGetFormat(c *C) {
+	v := firstVariant(c)
+	dp, err := v.GetFormat("DP")
+	c.Assert(err, IsNil)
+	c.Assert(dp.([][]int)[0], DeepEquals, []int{1})
+	c.Assert(dp.([][]int)[1], DeepEquals, []int{MissingInt})
+
+	gl, err := v.FormatFloats("GL")
+	c.Assert(err, IsNil)
+	c.Assert(gl[0], HasLen, 3)
+	c.Assert(math.Abs(float64(gl[0][1])+0.30103) < 1e-5, Equals, true)
+	c.Assert(math.IsNaN(float64(gl[1][0])), Equals, true)
+
+	_, err = v.GetFormat("NOPE")
+	c.Assert(err, NotNil)
+	_, err = v.FormatInts("GL")
+	c.Assert(err, NotNil)
+}
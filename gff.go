@@ -0,0 +1,111 @@
+package cgotabix
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Feature is a line of a GFF3 or GTF file. Its 1-based inclusive coordinates
+// are converted to the 0-based half-open Start and End used everywhere else.
+type Feature struct {
+	*Record
+	attributes map[string]string
+}
+
+// NewFeature parses the 9 columns of a GFF3 or GTF line.
+func NewFeature(line string) (*Feature, error) {
+	r, err := NewRecord(line, PresetGFF)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.fields) < 9 {
+		return nil, fmt.Errorf("expected 9 columns in GFF line, got %d", len(r.fields))
+	}
+	return &Feature{Record: r, attributes: parseAttributes(r.fields[8])}, nil
+}
+
+// parseAttributes handles both GFF3 (key=value;key=value) and GTF
+// (key "value"; key "value";) attributes. Repeated GTF keys are joined by ",".
+func parseAttributes(col string) map[string]string {
+	attrs := make(map[string]string)
+	if col == "." {
+		return attrs
+	}
+	for _, kv := range strings.Split(col, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		var key, val string
+		if eq := strings.IndexByte(kv, '='); eq > 0 && !strings.ContainsRune(kv[:eq], ' ') {
+			key, val = kv[:eq], kv[eq+1:]
+			if v, err := url.PathUnescape(val); err == nil {
+				val = v
+			}
+		} else if sp := strings.IndexByte(kv, ' '); sp > 0 {
+			key, val = kv[:sp], strings.Trim(strings.TrimSpace(kv[sp+1:]), "\"")
+			if prev, ok := attrs[key]; ok {
+				val = prev + "," + val
+			}
+		} else {
+			key = kv
+		}
+		attrs[key] = val
+	}
+	return attrs
+}
+
+// Seqid is the first column. It is the same as Chrom.
+func (f *Feature) Seqid() string {
+	return f.fields[0]
+}
+
+// GFFSource is the second column, the program or database that produced the
+// feature.
+func (f *Feature) GFFSource() string {
+	return f.fields[1]
+}
+
+// Type is the third column, e.g. gene, exon or CDS.
+func (f *Feature) Type() string {
+	return f.fields[2]
+}
+
+// Score returns the sixth column and false if it is ".".
+func (f *Feature) Score() (float64, bool) {
+	s, err := strconv.ParseFloat(f.fields[5], 64)
+	if err != nil {
+		return 0, false
+	}
+	return s, true
+}
+
+// Strand returns '+', '-', '.' or '?'.
+func (f *Feature) Strand() byte {
+	if f.fields[6] == "" {
+		return '.'
+	}
+	return f.fields[6][0]
+}
+
+// Phase returns 0, 1 or 2 for CDS features and -1 if it is ".".
+func (f *Feature) Phase() int {
+	p, err := strconv.Atoi(f.fields[7])
+	if err != nil {
+		return -1
+	}
+	return p
+}
+
+// Attributes returns the key/value pairs of the ninth column.
+func (f *Feature) Attributes() map[string]string {
+	return f.attributes
+}
+
+// Attribute returns the value of key and whether it was present.
+func (f *Feature) Attribute(key string) (string, bool) {
+	v, ok := f.attributes[key]
+	return v, ok
+}
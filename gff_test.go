@@ -0,0 +1,54 @@
+package cgotabix
+
+import (
+	"fmt"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestFeature(c *C) {
+	path := filepath.Join(c.MkDir(), "genes.gff3.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Level: -1, Index: &PresetGFF})
+	c.Assert(err, IsNil)
+	fmt.Fprintf(w, "##gff-version 3\n")
+	fmt.Fprintf(w, "1\thavana\tgene\t1001\t2000\t.\t+\t.\tID=gene1;Name=ABC%%3B1\n")
+	fmt.Fprintf(w, "1\thavana\tCDS\t1101\t1200\t3.5\t+\t2\tParent=gene1\n")
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.Type(), Equals, GFF)
+	res := t.Get(Position{"1", 1000, 1001})
+	c.Assert(res, HasLen, 1)
+	f := res[0].(*Feature)
+	c.Assert(f.Start(), Equals, uint32(1000))
+	c.Assert(f.End(), Equals, uint32(2000))
+	c.Assert(f.Type(), Equals, "gene")
+	c.Assert(f.GFFSource(), Equals, "havana")
+	c.Assert(f.Strand(), Equals, byte('+'))
+	c.Assert(f.Phase(), Equals, -1)
+	_, ok := f.Score()
+	c.Assert(ok, Equals, false)
+	c.Assert(f.Attributes(), DeepEquals, map[string]string{"ID": "gene1", "Name": "ABC;1"})
+
+	res = t.Get(Position{"1", 1150, 1151})
+	c.Assert(res, HasLen, 2)
+	cds := res[1].(*Feature)
+	c.Assert(cds.Phase(), Equals, 2)
+	score, ok := cds.Score()
+	c.Assert(ok, Equals, true)
+	c.Assert(score, Equals, 3.5)
+}
+
+func (s *TSuite) TestGTFAttributes(c *C) {
+	f, err := NewFeature("chr1\tHAVANA\texon\t11869\t12227\t.\t+\t.\tgene_id \"ENSG1\"; gene_name \"DDX11L1\"; tag \"basic\"; tag \"CCDS\";")
+	c.Assert(err, IsNil)
+	c.Assert(f.Start(), Equals, uint32(11868))
+	c.Assert(f.End(), Equals, uint32(12227))
+	v, ok := f.Attribute("gene_name")
+	c.Assert(ok, Equals, true)
+	c.Assert(v, Equals, "DDX11L1")
+	v, _ = f.Attribute("tag")
+	c.Assert(v, Equals, "basic,CCDS")
+}
@@ -0,0 +1,215 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/kstring.h"
+#include "htslib/vcf.h"
+
+int hdr_nhrec(bcf_hdr_t *h) {
+	return h->nhrec;
+}
+
+bcf_hrec_t *hdr_hrec(bcf_hdr_t *h, int i) {
+	return h->hrec[i];
+}
+
+char *hrec_key(bcf_hrec_t *r, int i) {
+	return r->keys[i];
+}
+
+char *hrec_val(bcf_hrec_t *r, int i) {
+	return r->vals[i];
+}
+
+int hdr_nsamples(bcf_hdr_t *h) {
+	return bcf_hdr_nsamples(h);
+}
+
+char *hdr_sample(bcf_hdr_t *h, int i) {
+	return h->samples[i];
+}
+*/
+import "C"
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/brentp/xopen"
+)
+
+// MetaLine is a ##key=value line of a VCF header. For structured lines like
+// ##INFO=<...>, Value is the text between the angle brackets.
+type MetaLine struct {
+	Key   string
+	Value string
+}
+
+// FieldDef is an INFO, FORMAT or FILTER definition from a VCF header.
+// FILTER definitions have no Number or Type.
+type FieldDef struct {
+	ID          string
+	Number      string
+	Type        string
+	Description string
+}
+
+// Header is a copy of the header of a Tabix at the time Header was called.
+type Header struct {
+	// Text is the full header, for VCFs including the #CHROM line.
+	Text string
+	// Samples are the sample names of a VCF or BCF.
+	Samples []string
+	// Meta holds every ## line of a VCF or BCF in file order.
+	Meta    []MetaLine
+	Infos   []FieldDef
+	Formats []FieldDef
+	Filters []FieldDef
+	// Lines are the leading comment, track and browser lines of other files.
+	Lines []string
+}
+
+// Info returns the INFO definition for id.
+func (h *Header) Info(id string) (FieldDef, bool) {
+	return findDef(h.Infos, id)
+}
+
+// Format returns the FORMAT definition for id.
+func (h *Header) Format(id string) (FieldDef, bool) {
+	return findDef(h.Formats, id)
+}
+
+// Filter returns the FILTER definition for id.
+func (h *Header) Filter(id string) (FieldDef, bool) {
+	return findDef(h.Filters, id)
+}
+
+func findDef(defs []FieldDef, id string) (FieldDef, bool) {
+	for _, d := range defs {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return FieldDef{}, false
+}
+
+// Header returns the header of a VCF or BCF or the leading header lines of
+// other file types.
+func (t *Tabix) Header() (*Header, error) {
+	t.mu.RLock()
+	closed, header := t.closed, t.header
+	// Close frees tbx, so its preset is copied while mu is held.
+	var preset *Preset
+	if !closed && t.tbx != nil {
+		p := presetFromConf(t.tbx.conf)
+		preset = &p
+	}
+	t.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if header == nil {
+		return t.textHeader(preset)
+	}
+	// header keeps hdr alive if a line is added meanwhile.
+	defer runtime.KeepAlive(header)
+	hdr := header.hdr
+	h := &Header{}
+	kstr := C.kstring_t{}
+	if C.bcf_hdr_format(hdr, 0, &kstr) != 0 {
+		C.free(unsafe.Pointer(kstr.s))
+		return nil, fmt.Errorf("unable to format header of %s", t.path)
+	}
+	h.Text = C.GoStringN(kstr.s, C.int(kstr.l))
+	C.free(unsafe.Pointer(kstr.s))
+
+	n := int(C.hdr_nsamples(hdr))
+	h.Samples = make([]string, n)
+	for i := 0; i < n; i++ {
+		h.Samples[i] = C.GoString(C.hdr_sample(hdr, C.int(i)))
+	}
+
+	for i := 0; i < int(C.hdr_nhrec(hdr)); i++ {
+		rec := C.hdr_hrec(hdr, C.int(i))
+		key := C.GoString(rec.key)
+		if rec.value != nil {
+			h.Meta = append(h.Meta, MetaLine{Key: key, Value: C.GoString(rec.value)})
+			continue
+		}
+		vals := make([]string, 0, int(rec.nkeys))
+		def := FieldDef{}
+		for k := 0; k < int(rec.nkeys); k++ {
+			hk := C.GoString(C.hrec_key(rec, C.int(k)))
+			hv := C.GoString(C.hrec_val(rec, C.int(k)))
+			// htslib appends an IDX key that isn't in the file.
+			if hk == "IDX" {
+				continue
+			}
+			vals = append(vals, hk+"="+hv)
+			switch hk {
+			case "ID":
+				def.ID = hv
+			case "Number":
+				def.Number = hv
+			case "Type":
+				def.Type = hv
+			case "Description":
+				def.Description = unquote(hv)
+			}
+		}
+		h.Meta = append(h.Meta, MetaLine{Key: key, Value: strings.Join(vals, ",")})
+		switch int(rec._type) {
+		case C.BCF_HL_INFO:
+			h.Infos = append(h.Infos, def)
+		case C.BCF_HL_FMT:
+			h.Formats = append(h.Formats, def)
+		case C.BCF_HL_FLT:
+			h.Filters = append(h.Filters, def)
+		}
+	}
+	return h, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.Replace(s[1:len(s)-1], "\\\"", "\"", -1)
+	}
+	return s
+}
+
+// textHeader reads the leading lines of a text file that start with the
+// meta character of the index or with "track" or "browser", along with the
+// lines the preset of the index says to skip.
+func (t *Tabix) textHeader(preset *Preset) (*Header, error) {
+	meta, skip := "#", 0
+	if preset != nil {
+		meta, skip = string(preset.MetaChar), preset.LineSkip
+	}
+	rdr, err := xopen.Ropen(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	h := &Header{}
+	for i := 0; ; i++ {
+		line, err := rdr.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if i >= skip && !strings.HasPrefix(line, meta) && !strings.HasPrefix(line, "track") && !strings.HasPrefix(line, "browser") {
+			break
+		}
+		h.Lines = append(h.Lines, line)
+	}
+	if len(h.Lines) > 0 {
+		h.Text = strings.Join(h.Lines, "\n") + "\n"
+	}
+	return h, nil
+}
@@ -0,0 +1,204 @@
+package cgotabix
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestHeader(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(h.Text, "##fileformat=VCFv4.1\n"), Equals, true)
+	c.Assert(strings.Contains(h.Text, "#CHROM\tPOS"), Equals, true)
+	c.Assert(h.Samples[0], Equals, "NA06984")
+	c.Assert(h.Meta[0], Equals, MetaLine{Key: "fileformat", Value: "VCFv4.1"})
+
+	dp, ok := h.Info("DP")
+	c.Assert(ok, Equals, true)
+	c.Assert(dp, Equals, FieldDef{ID: "DP", Number: "1", Type: "Integer", Description: "Total read depth at the locus"})
+	ao, ok := h.Format("AO")
+	c.Assert(ok, Equals, true)
+	c.Assert(ao.Number, Equals, "A")
+	pass, ok := h.Filter("PASS")
+	c.Assert(ok, Equals, true)
+	c.Assert(pass.Description, Equals, "All filters passed")
+	_, ok = h.Info("NOPE")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *TSuite) TestTextHeader(c *C) {
+	path := filepath.Join(c.MkDir(), "t.bed.gz")
+	preset := PresetBED
+	preset.LineSkip = 1
+	w, err := NewBGZFWriter(path, &BGZFOptions{Level: -1, Index: &preset})
+	c.Assert(err, IsNil)
+	fmt.Fprintf(w, "track name=t\n#chrom\tstart\tend\nchr1\t1\t2\n#not header\n")
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	c.Assert(h.Lines, DeepEquals, []string{"track name=t", "#chrom\tstart\tend"})
+	c.Assert(h.Samples, HasLen, 0)
+}
+
+func (s *TSuite) TestAddToHeader(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.AddInfoToHeader("XX", "A", "Float", `a "quoted" word`), IsNil)
+	c.Assert(t.AddInfoToHeader("FL", "0", "Flag", "a flag"), IsNil)
+	c.Assert(t.AddFormatToHeader("XF", "1", "Integer", "xf"), IsNil)
+	c.Assert(t.AddFilterToHeader("LowQ", "low quality"), IsNil)
+	c.Assert(t.AddContigToHeader("2", 243199373), IsNil)
+
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	xx, ok := h.Info("XX")
+	c.Assert(ok, Equals, true)
+	c.Assert(xx.Number, Equals, "A")
+	_, ok = h.Format("XF")
+	c.Assert(ok, Equals, true)
+	_, ok = h.Filter("LowQ")
+	c.Assert(ok, Equals, true)
+	c.Assert(t.Contigs()[1], Equals, Contig{Name: "2", Length: 243199373})
+
+	for _, bad := range [][]string{
+		{"1X", "1", "Integer"},
+		{"X", "B", "Integer"},
+		{"X", "1", "Double"},
+		{"X", "1", "Flag"},
+	} {
+		err = t.AddInfoToHeader(bad[0], bad[1], bad[2], "bad")
+		_, ok := err.(*HeaderError)
+		c.Assert(ok, Equals, true, Commentf("%v", bad))
+	}
+	c.Assert(t.AddFormatToHeader("F", "0", "Flag", "bad"), NotNil)
+	c.Assert(t.AddContigToHeader("bad contig", 0), NotNil)
+
+	// existing IDs are skipped when they agree and an error otherwise.
+	version := t.header.version
+	c.Assert(t.AddInfoToHeader("DP", "1", "Integer", "again"), IsNil)
+	c.Assert(t.AddFilterToHeader("LowQ", "again"), IsNil)
+	c.Assert(t.AddContigToHeader("2", 0), IsNil)
+	c.Assert(t.header.version, Equals, version)
+	err = t.AddInfoToHeader("DP", "A", "Float", "conflict")
+	_, ok = err.(*HeaderError)
+	c.Assert(ok, Equals, true)
+	c.Assert(t.AddFormatToHeader("XF", "1", "Float", "conflict"), NotNil)
+	c.Assert(t.AddContigToHeader("2", 5), NotNil)
+	h, err = t.Header()
+	c.Assert(err, IsNil)
+	dp, _ := h.Info("DP")
+	c.Assert(dp.Type, Equals, "Integer")
+}
+
+func (s *TSuite) TestAddToHeaderNotVCF(c *C) {
+	path := filepath.Join(c.MkDir(), "t.bed.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Level: -1, Index: &PresetBED})
+	c.Assert(err, IsNil)
+	fmt.Fprintf(w, "chr1\t1\t2\n")
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.AddInfoToHeader("X", "1", "Integer", "x"), NotNil)
+}
+
+func (s *TSuite) TestSamples(c *C) {
+	t, err := NewWithOptions("vt.norm.vcf.gz", Options{Samples: []string{"NA06985"}})
+	c.Assert(err, IsNil)
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	c.Assert(h.Samples, DeepEquals, []string{"NA06985"})
+	vs := t.Get(Position{"1", 54719, 54720})
+	gts, err := vs[0].(*Variant).Genotypes()
+	c.Assert(err, IsNil)
+	c.Assert(gts, DeepEquals, []Genotype{{Alleles: []int{-1, -1}, Phased: true}})
+
+	// the subset survives changes to the header.
+	c.Assert(t.AddInfoToHeader("XX", "1", "Integer", "xx"), IsNil)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+	vs = t.Get(Position{"1", 54719, 54720})
+	gts, err = vs[0].(*Variant).Genotypes()
+	c.Assert(err, IsNil)
+	c.Assert(gts, HasLen, 1)
+
+	t, err = NewWithOptions("vt.norm.vcf.gz", Options{Samples: []string{"NA06984"}, ExcludeSamples: true})
+	c.Assert(err, IsNil)
+	h, err = t.Header()
+	c.Assert(err, IsNil)
+	c.Assert(h.Samples[0], Equals, "NA06985")
+
+	t, err = NewWithOptions("vt.norm.vcf.gz", Options{Samples: []string{}})
+	c.Assert(err, IsNil)
+	h, err = t.Header()
+	c.Assert(err, IsNil)
+	c.Assert(h.Samples, HasLen, 0)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+
+	_, err = NewWithOptions("vt.norm.vcf.gz", Options{Samples: []string{"NOT-A-SAMPLE"}})
+	c.Assert(err, NotNil)
+}
+
+func (s *TSuite) TestUndeclaredTags(c *C) {
+	path := filepath.Join(c.MkDir(), "u.vcf.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Index: &PresetVCF})
+	c.Assert(err, IsNil)
+	fmt.Fprint(w, "##fileformat=VCFv4.2\n##contig=<ID=1>\n")
+	fmt.Fprint(w, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	fmt.Fprint(w, "1\t10\ta\tA\tC\t.\t.\t.\n1\t20\tb\tA\tC\t.\t.\tXX=hi\n2\t30\tc\tA\tC\t.\t.\t.\n")
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	first := t.Get(Position{"1", 9, 10})[0].(*Variant)
+	second := t.Get(Position{"1", 19, 20})[0].(*Variant)
+	third := t.Get(Position{"2", 29, 30})[0].(*Variant)
+
+	// each undeclared tag made a new header; earlier Variants keep theirs.
+	c.Assert(first.header.version, Equals, 0)
+	c.Assert(second.header.version, Equals, 1)
+	c.Assert(third.header.version, Equals, 2)
+	c.Assert(first.Chrom(), Equals, "1")
+	c.Assert(third.Chrom(), Equals, "2")
+	xx, err := second.Info().Get("XX")
+	c.Assert(err, IsNil)
+	c.Assert(xx, Equals, "hi")
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	_, ok := h.Info("XX")
+	c.Assert(ok, Equals, true)
+	c.Assert(t.Contigs(), HasLen, 2)
+}
+
+func (s *TSuite) TestUndeclaredTagsAfterWrite(c *C) {
+	path := filepath.Join(c.MkDir(), "u.vcf.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Index: &PresetVCF})
+	c.Assert(err, IsNil)
+	fmt.Fprint(w, "##fileformat=VCFv4.2\n##contig=<ID=1>\n")
+	fmt.Fprint(w, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	fmt.Fprint(w, "1\t10\ta\tA\tC\t.\t.\t.\n1\t20\tb\tA\tC\t.\t.\tXX=hi\n")
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	out, err := NewWriter(filepath.Join(c.MkDir(), "out.vcf"), t, OutputVCF)
+	c.Assert(err, IsNil)
+	c.Assert(out.Write(t.Get(Position{"1", 9, 10})[0].(*Variant)), IsNil)
+
+	// XX can't be added to the header the Writer has already written.
+	_, err = t.Query(Position{"1", 19, 20})
+	c.Assert(errors.Is(err, ErrHeaderWritten), Equals, true)
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	_, ok := h.Info("XX")
+	c.Assert(ok, Equals, false)
+	c.Assert(out.Close(), IsNil)
+}
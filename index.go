@@ -0,0 +1,109 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/hts.h"
+#include "htslib/tbx.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/brentp/xopen"
+)
+
+const TBX_GENERIC int = 0
+const TBX_SAM int = 1
+const TBX_VCF int = 2
+const TBX_UCSC int = 0x10000
+
+// Preset tells tabix which columns hold the position of each line. It mirrors
+// htslib's tbx_conf_t: columns are 1-based and an EndCol of 0 means the end is
+// derived from the record itself (REF length for VCF, CIGAR for SAM) or is
+// one base past the begin.
+type Preset struct {
+	// Format is TBX_GENERIC, TBX_SAM or TBX_VCF, optionally or'ed with
+	// TBX_UCSC when BeginCol is 0-based as in BED.
+	Format   int
+	SeqCol   int
+	BeginCol int
+	EndCol   int
+	// Lines starting with MetaChar are skipped, as are the first LineSkip lines.
+	MetaChar byte
+	LineSkip int
+}
+
+// The presets used by `tabix -p`.
+var (
+	PresetGFF = Preset{Format: TBX_GENERIC, SeqCol: 1, BeginCol: 4, EndCol: 5, MetaChar: '#'}
+	PresetBED = Preset{Format: TBX_GENERIC | TBX_UCSC, SeqCol: 1, BeginCol: 2, EndCol: 3, MetaChar: '#'}
+	PresetSAM = Preset{Format: TBX_SAM, SeqCol: 3, BeginCol: 4, MetaChar: '@'}
+	PresetVCF = Preset{Format: TBX_VCF, SeqCol: 1, BeginCol: 2, MetaChar: '#'}
+)
+
+// ErrNotBGZF is returned when a file to be indexed is not bgzip compressed.
+var ErrNotBGZF = errors.New("cgotabix: file is not BGZF compressed")
+
+func (p Preset) conf() C.tbx_conf_t {
+	return C.tbx_conf_t{
+		preset:    C.int32_t(p.Format),
+		sc:        C.int32_t(p.SeqCol),
+		bc:        C.int32_t(p.BeginCol),
+		ec:        C.int32_t(p.EndCol),
+		meta_char: C.int32_t(p.MetaChar),
+		line_skip: C.int32_t(p.LineSkip),
+	}
+}
+
+func presetFromConf(c C.tbx_conf_t) Preset {
+	return Preset{
+		Format:   int(c.preset),
+		SeqCol:   int(c.sc),
+		BeginCol: int(c.bc),
+		EndCol:   int(c.ec),
+		MetaChar: byte(c.meta_char),
+		LineSkip: int(c.line_skip),
+	}
+}
+
+// BuildIndex writes a .tbi index next to the bgzipped file at path.
+func BuildIndex(path string, preset Preset) error {
+	return buildIndex(path, path+".tbi", preset, 0)
+}
+
+// BuildIndexCSI writes a .csi index next to the bgzipped file at path with
+// a smallest bin of 2^minShift bases. CSI is needed for contigs longer than
+// 2^29 bases. A minShift <= 0 uses 14, the same bin size as .tbi.
+func BuildIndexCSI(path string, preset Preset, minShift int) error {
+	if minShift <= 0 {
+		minShift = tbiMinShift
+	}
+	return buildIndex(path, path+".csi", preset, minShift)
+}
+
+// buildIndex writes a TBI index to index if minShift is 0 and a CSI index
+// otherwise.
+func buildIndex(path, index string, preset Preset, minShift int) error {
+	if !xopen.Exists(path) {
+		return fmt.Errorf("cgotabix: no such file %s", path)
+	}
+	if preset.SeqCol < 1 || preset.BeginCol < 1 || preset.EndCol < 0 {
+		return fmt.Errorf("cgotabix: invalid columns in preset %+v", preset)
+	}
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	ci := C.CString(index)
+	defer C.free(unsafe.Pointer(ci))
+
+	conf := preset.conf()
+	switch C.tbx_index_build2(cs, ci, C.int(minShift), &conf) {
+	case 0:
+		return nil
+	case -2:
+		return fmt.Errorf("%w: %s", ErrNotBGZF, path)
+	default:
+		return fmt.Errorf("cgotabix: error building index %s for %s", index, path)
+	}
+}
@@ -0,0 +1,49 @@
+package cgotabix
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+// copyVCF copies the test vcf into dir so that it can be indexed there.
+func copyVCF(c *C, dir string) string {
+	data, err := ioutil.ReadFile("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	path := filepath.Join(dir, "vt.norm.vcf.gz")
+	c.Assert(ioutil.WriteFile(path, data, 0644), IsNil)
+	return path
+}
+
+func (s *TSuite) TestBuildIndex(c *C) {
+	path := copyVCF(c, c.MkDir())
+	c.Assert(BuildIndex(path, PresetVCF), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.IndexPath(), Equals, path+".tbi")
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+}
+
+func (s *TSuite) TestBuildIndexCSI(c *C) {
+	path := copyVCF(c, c.MkDir())
+	c.Assert(BuildIndexCSI(path, PresetVCF, 12), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.IndexPath(), Equals, path+".csi")
+	c.Assert(t.MinShift(), Equals, 12)
+	c.Assert(t.Get(Position{"1", 50000, 90000}), HasLen, 15)
+	i := 0
+	for _ = range t.At("1:50000-90000") {
+		i += 1
+	}
+	c.Assert(i, Equals, 15)
+}
+
+func (s *TSuite) TestBuildIndexNotBGZF(c *C) {
+	path := filepath.Join(c.MkDir(), "plain.bed")
+	c.Assert(ioutil.WriteFile(path, []byte("1\t10\t20\n"), 0644), IsNil)
+	c.Assert(BuildIndex(path, PresetBED), NotNil)
+}
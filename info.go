@@ -0,0 +1,359 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/vcf.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unsafe"
+)
+
+// The reasons for an InfoError.
+var (
+	ErrNotDefined  = errors.New("not defined in the header")
+	ErrNotPresent  = errors.New("not present in the record")
+	ErrWrongType   = errors.New("wrong type")
+	ErrMissing     = errors.New("missing value")
+	ErrWrongNumber = errors.New("wrong number of values")
+)
+
+// InfoError is returned by the typed INFO getters. Err is one of
+// ErrNotDefined, ErrNotPresent, ErrWrongType, ErrMissing or ErrWrongNumber,
+// possibly wrapped.
+type InfoError struct {
+	Key string
+	Err error
+}
+
+func (e *InfoError) Error() string {
+	return fmt.Sprintf("cgotabix: INFO/%s: %s", e.Key, e.Err)
+}
+
+func (e *InfoError) Unwrap() error {
+	return e.Err
+}
+
+// values calls bcf_get_info_values and turns its return codes into an
+// InfoError. The caller must free *dst.
+func (i *INFO) values(key string, dst *unsafe.Pointer, htype C.int) (int, error) {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var ndst C.int
+	n := C.bcf_get_info_values(i.hdr, i.b, ckey, dst, &ndst, htype)
+	switch {
+	case n == -1:
+		return 0, &InfoError{Key: key, Err: ErrNotDefined}
+	case n == -2:
+		return 0, &InfoError{Key: key, Err: ErrWrongType}
+	case n == -3:
+		return 0, &InfoError{Key: key, Err: ErrNotPresent}
+	case n < 0:
+		return 0, &InfoError{Key: key, Err: fmt.Errorf("error %d reading value", int(n))}
+	}
+	return int(n), nil
+}
+
+// GetInts returns the values of an Integer INFO field. ok[i] is false where
+// the value is missing ('.').
+func (i *INFO) GetInts(key string) (vals []int, ok []bool, err error) {
+	var dst unsafe.Pointer
+	n, err := i.values(key, &dst, C.BCF_HT_INT)
+	defer C.free(dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	slice := (*[1 << 28]C.int32_t)(dst)[:n:n]
+	vals, ok = make([]int, 0, n), make([]bool, 0, n)
+	for _, v := range slice {
+		if v == C.bcf_int32_vector_end {
+			break
+		}
+		missing := v == C.bcf_int32_missing
+		if missing {
+			vals = append(vals, 0)
+		} else {
+			vals = append(vals, int(v))
+		}
+		ok = append(ok, !missing)
+	}
+	return vals, ok, nil
+}
+
+// GetInt returns the value of an Integer INFO field with a single value.
+func (i *INFO) GetInt(key string) (int, error) {
+	vals, ok, err := i.GetInts(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) != 1 {
+		return 0, &InfoError{Key: key, Err: fmt.Errorf("%w: %d values", ErrWrongNumber, len(vals))}
+	}
+	if !ok[0] {
+		return 0, &InfoError{Key: key, Err: ErrMissing}
+	}
+	return vals[0], nil
+}
+
+// GetFloats returns the values of a Float INFO field. ok[i] is false where
+// the value is missing ('.').
+func (i *INFO) GetFloats(key string) (vals []float64, ok []bool, err error) {
+	var dst unsafe.Pointer
+	n, err := i.values(key, &dst, C.BCF_HT_REAL)
+	defer C.free(dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	slice := (*[1 << 28]C.float)(dst)[:n:n]
+	vals, ok = make([]float64, 0, n), make([]bool, 0, n)
+	for _, v := range slice {
+		if C.bcf_float_is_vector_end(v) != 0 {
+			break
+		}
+		missing := C.bcf_float_is_missing(v) != 0
+		if missing {
+			vals = append(vals, 0)
+		} else {
+			vals = append(vals, float64(v))
+		}
+		ok = append(ok, !missing)
+	}
+	return vals, ok, nil
+}
+
+// GetFloat returns the value of a Float INFO field with a single value.
+func (i *INFO) GetFloat(key string) (float64, error) {
+	vals, ok, err := i.GetFloats(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) != 1 {
+		return 0, &InfoError{Key: key, Err: fmt.Errorf("%w: %d values", ErrWrongNumber, len(vals))}
+	}
+	if !ok[0] {
+		return 0, &InfoError{Key: key, Err: ErrMissing}
+	}
+	return vals[0], nil
+}
+
+// GetString returns the value of a String or Character INFO field as it is
+// written in the file, including any commas.
+func (i *INFO) GetString(key string) (string, error) {
+	var dst unsafe.Pointer
+	n, err := i.values(key, &dst, C.BCF_HT_STR)
+	defer C.free(dst)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimRight(C.GoStringN((*C.char)(dst), C.int(n)), "\x00")
+	if v == "." {
+		return "", &InfoError{Key: key, Err: ErrMissing}
+	}
+	return v, nil
+}
+
+// GetStrings splits a String INFO field on commas. ok[i] is false where the
+// value is missing ('.').
+func (i *INFO) GetStrings(key string) (vals []string, ok []bool, err error) {
+	v, err := i.GetString(key)
+	if err != nil {
+		if ie, isInfo := err.(*InfoError); isInfo && ie.Err == ErrMissing {
+			return []string{""}, []bool{false}, nil
+		}
+		return nil, nil, err
+	}
+	vals = strings.Split(v, ",")
+	ok = make([]bool, len(vals))
+	for k, s := range vals {
+		if s == "." {
+			vals[k] = ""
+		} else {
+			ok[k] = true
+		}
+	}
+	return vals, ok, nil
+}
+
+// GetFlag reports whether a Flag INFO field is set.
+func (i *INFO) GetFlag(key string) (bool, error) {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var ndst C.int
+	n := C.bcf_get_info_values(i.hdr, i.b, ckey, nil, &ndst, C.BCF_HT_FLAG)
+	switch {
+	case n == -1:
+		return false, &InfoError{Key: key, Err: ErrNotDefined}
+	case n == -2:
+		return false, &InfoError{Key: key, Err: ErrWrongType}
+	case n < 0:
+		return false, &InfoError{Key: key, Err: fmt.Errorf("error %d reading value", int(n))}
+	}
+	if n != 1 {
+		return false, nil
+	}
+	// htslib still reports a flag that was unset with Set(key, false).
+	info := C.bcf_get_info(i.hdr, i.b, ckey)
+	return info != nil && info.vptr != nil, nil
+}
+
+// toInt32s converts the value given to INFO.Set for an Integer field.
+func toInt32s(value interface{}) ([]int32, error) {
+	var vals []int64
+	switch v := value.(type) {
+	case int:
+		vals = []int64{int64(v)}
+	case int8:
+		vals = []int64{int64(v)}
+	case int16:
+		vals = []int64{int64(v)}
+	case int32:
+		vals = []int64{int64(v)}
+	case int64:
+		vals = []int64{v}
+	case uint8:
+		vals = []int64{int64(v)}
+	case uint16:
+		vals = []int64{int64(v)}
+	case uint32:
+		vals = []int64{int64(v)}
+	case []int:
+		for _, x := range v {
+			vals = append(vals, int64(x))
+		}
+	case []int32:
+		for _, x := range v {
+			vals = append(vals, int64(x))
+		}
+	case []int64:
+		vals = v
+	case []uint32:
+		for _, x := range v {
+			vals = append(vals, int64(x))
+		}
+	case uint, uint64, []uint64:
+		var us []uint64
+		switch u := v.(type) {
+		case uint:
+			us = []uint64{uint64(u)}
+		case uint64:
+			us = []uint64{u}
+		case []uint64:
+			us = u
+		}
+		for _, x := range us {
+			if x > math.MaxInt32 {
+				return nil, fmt.Errorf("%d overflows Integer", x)
+			}
+			vals = append(vals, int64(x))
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T for Integer", ErrWrongType, value)
+	}
+	out := make([]int32, len(vals))
+	for k, x := range vals {
+		// BCF reserves the values just above MissingInt.
+		if x < math.MinInt32 || x > math.MaxInt32 || (x > MissingInt && x < MissingInt+8) {
+			return nil, fmt.Errorf("%d overflows Integer", x)
+		}
+		out[k] = int32(x)
+	}
+	return out, nil
+}
+
+// toFloat32s converts the value given to INFO.Set for a Float field.
+func toFloat32s(value interface{}) ([]float32, error) {
+	switch v := value.(type) {
+	case float32:
+		return []float32{v}, nil
+	case float64:
+		return toFloat32s([]float64{v})
+	case []float32:
+		return v, nil
+	case []float64:
+		out := make([]float32, len(v))
+		for k, x := range v {
+			if !math.IsNaN(x) && !math.IsInf(x, 0) && math.Abs(x) > math.MaxFloat32 {
+				return nil, fmt.Errorf("%g overflows Float", x)
+			}
+			out[k] = float32(x)
+		}
+		return out, nil
+	}
+	ints, err := toInt32s(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %T for Float", ErrWrongType, value)
+	}
+	out := make([]float32, len(ints))
+	for k, x := range ints {
+		out[k] = float32(x)
+	}
+	return out, nil
+}
+
+// toStrings converts the value given to INFO.Set for a String field.
+func toStrings(value interface{}) ([]string, error) {
+	var vals []string
+	switch v := value.(type) {
+	case string:
+		vals = []string{v}
+	case []string:
+		vals = v
+		for _, s := range vals {
+			if strings.ContainsRune(s, ',') {
+				return nil, fmt.Errorf("%q in a list can't contain a comma", s)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T for String", ErrWrongType, value)
+	}
+	for _, s := range vals {
+		// htslib would store "" as a zero-length value; "." is missing.
+		if s == "" {
+			return nil, fmt.Errorf("empty string, use \".\" for a missing value")
+		}
+		if strings.ContainsAny(s, ";\t\n") {
+			return nil, fmt.Errorf("%q can't contain ';', tab or newline", s)
+		}
+	}
+	return vals, nil
+}
+
+// declare adds key to the header of the owning Tabix with a Type and Number
+// inferred from value and translates the Variant to the new header.
+func (i *INFO) declare(key string, value interface{}) error {
+	number, vtype := inferInfoType(value)
+	if vtype == "" {
+		return &InfoError{Key: key, Err: fmt.Errorf("%w: can't infer a Type from %T", ErrWrongType, value)}
+	}
+	if err := i.t.declareInfo(key, number, vtype); err != nil {
+		return &InfoError{Key: key, Err: err}
+	}
+	return i.translate(i.t, i.b)
+}
+
+// inferInfoType returns the Number and Type of an INFO field holding value,
+// or "" for the Type if value can't be stored in INFO. Slices get Number=.
+// as other records may hold a different number of values.
+func inferInfoType(value interface{}) (number, vtype string) {
+	switch value.(type) {
+	case bool:
+		return "0", "Flag"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "1", "Integer"
+	case []int, []int32, []int64, []uint32, []uint64:
+		return ".", "Integer"
+	case float32, float64:
+		return "1", "Float"
+	case []float32, []float64:
+		return ".", "Float"
+	case string:
+		return "1", "String"
+	case []string:
+		return ".", "String"
+	}
+	return "", ""
+}
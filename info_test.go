@@ -0,0 +1,229 @@
+package cgotabix
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestInfoKeys(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.AddInfoToHeader("FL", "0", "Flag", "a flag"), IsNil)
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	info := v.Info().(*INFO)
+
+	keys := info.Keys()
+	c.Assert(keys[:3], DeepEquals, []string{"AB", "ABP", "AC"})
+	c.Assert(keys[len(keys)-1], Equals, "OLD_VARIANT")
+
+	c.Assert(info.Set("FL", true), IsNil)
+	keys = info.Keys()
+	c.Assert(keys[len(keys)-1], Equals, "FL")
+	fl, err := info.Get("FL")
+	c.Assert(err, IsNil)
+	c.Assert(fl, Equals, true)
+
+	info.Delete("AB")
+	c.Assert(info.Keys()[0], Equals, "ABP")
+
+	fields := make(map[string]InfoField)
+	info.Each(func(f InfoField) bool {
+		fields[f.Key] = f
+		return true
+	})
+	c.Assert(fields["DP"], DeepEquals, InfoField{Key: "DP", Type: "Integer", Number: "1", Value: 775})
+	c.Assert(fields["AC"].Number, Equals, "A")
+	c.Assert(fields["AC"].Value, DeepEquals, []int{9, 7, 4})
+	c.Assert(fields["FL"], DeepEquals, InfoField{Key: "FL", Type: "Flag", Number: "0", Value: true})
+	_, ok := fields["AB"]
+	c.Assert(ok, Equals, false)
+
+	n := 0
+	info.Each(func(f InfoField) bool {
+		n++
+		return n < 2
+	})
+	c.Assert(n, Equals, 2)
+}
+
+func (s *TSuite) TestTypedInfo(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.AddInfoToHeader("FL", "0", "Flag", "a flag"), IsNil)
+	c.Assert(t.AddInfoToHeader("MI", ".", "Integer", "with missing"), IsNil)
+	c.Assert(t.AddInfoToHeader("MF", ".", "Float", "with missing"), IsNil)
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	info := v.Info().(*INFO)
+
+	dp, err := info.GetInt("DP")
+	c.Assert(err, IsNil)
+	c.Assert(dp, Equals, 775)
+	ac, ok, err := info.GetInts("AC")
+	c.Assert(err, IsNil)
+	c.Assert(ac, DeepEquals, []int{9, 7, 4})
+	c.Assert(ok, DeepEquals, []bool{true, true, true})
+	_, err = info.GetInt("AC")
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+
+	odds, err := info.GetFloat("ODDS")
+	c.Assert(err, IsNil)
+	c.Assert(odds > 0.4978 && odds < 0.4979, Equals, true)
+	_, err = info.GetFloat("DP")
+	c.Assert(errors.Is(err, ErrWrongType), Equals, true)
+	_, err = info.GetInt("NOPE")
+	c.Assert(errors.Is(err, ErrNotDefined), Equals, true)
+	_, err = info.GetInt("GTI")
+	c.Assert(err, IsNil)
+	_, _, err = info.GetInts("MI")
+	c.Assert(errors.Is(err, ErrNotPresent), Equals, true)
+
+	types, ok, err := info.GetStrings("TYPE")
+	c.Assert(err, IsNil)
+	c.Assert(types, DeepEquals, []string{"del", "ins", "ins"})
+	old, err := info.GetString("OLD_VARIANT")
+	c.Assert(err, IsNil)
+	c.Assert(old, Equals, "1:54720:CTTTCTT/CTTCTT")
+
+	c.Assert(info.Set("MI", []int{1, MissingInt, 3}), IsNil)
+	mi, ok, err := info.GetInts("MI")
+	c.Assert(err, IsNil)
+	c.Assert(mi, DeepEquals, []int{1, 0, 3})
+	c.Assert(ok, DeepEquals, []bool{true, false, true})
+	raw, err := info.Get("MI")
+	c.Assert(err, IsNil)
+	c.Assert(raw, DeepEquals, []int{1, MissingInt, 3})
+	info.Each(func(f InfoField) bool {
+		if f.Key == "MI" {
+			raw = f.Value
+		}
+		return true
+	})
+	c.Assert(raw, DeepEquals, []int{1, MissingInt, 3})
+	c.Assert(info.Set("MF", []float64{0.5, math.NaN(), 0.25}), IsNil)
+	raw, err = info.Get("MF")
+	c.Assert(err, IsNil)
+	mf := raw.([]float32)
+	c.Assert(mf, HasLen, 3)
+	c.Assert(math.IsNaN(float64(mf[1])), Equals, true)
+	c.Assert(mf[2], Equals, float32(0.25))
+
+	fl, err := info.GetFlag("FL")
+	c.Assert(err, IsNil)
+	c.Assert(fl, Equals, false)
+	c.Assert(info.Set("FL", true), IsNil)
+	fl, _ = info.GetFlag("FL")
+	c.Assert(fl, Equals, true)
+	c.Assert(info.Set("FL", false), IsNil)
+	fl, _ = info.GetFlag("FL")
+	c.Assert(fl, Equals, false)
+	_, err = info.GetFlag("DP")
+	c.Assert(errors.Is(err, ErrWrongType), Equals, true)
+}
+
+func (s *TSuite) TestSetInfo(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	info := v.Info().(*INFO)
+
+	// the record has one ALT, so Number=A fields take one value.
+	_, err = info.GetFloat("AF")
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+	err = info.Set("AF", []float64{0.25, 0.5, 0.125})
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+	c.Assert(info.Set("AF", []float64{0.25}), IsNil)
+	af, err := info.GetFloat("AF")
+	c.Assert(err, IsNil)
+	c.Assert(af, Equals, 0.25)
+	c.Assert(info.Set("DPB", 3), IsNil)
+	dpb, err := info.GetFloat("DPB")
+	c.Assert(err, IsNil)
+	c.Assert(dpb, Equals, 3.0)
+
+	err = info.Set("TYPE", []string{"snp", "del", "ins"})
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+	c.Assert(info.Set("TYPE", []string{"snp"}), IsNil)
+	types, _, err := info.GetStrings("TYPE")
+	c.Assert(err, IsNil)
+	c.Assert(types, DeepEquals, []string{"snp"})
+	c.Assert(info.Set("TYPE", []string{"a,b"}), NotNil)
+	c.Assert(info.Set("TYPE", []string{""}), NotNil)
+	c.Assert(info.Set("OLD_VARIANT", ""), NotNil)
+	old, err := info.Get("OLD_VARIANT")
+	c.Assert(err, IsNil)
+	c.Assert(old, Equals, "1:54720:CTTTCTT/CTTCTT")
+
+	c.Assert(info.Set("DP", int64(10)), IsNil)
+	dp, _ := info.GetInt("DP")
+	c.Assert(dp, Equals, 10)
+	err = info.Set("DP", int64(1)<<40)
+	c.Assert(err, NotNil)
+	dp, _ = info.GetInt("DP")
+	c.Assert(dp, Equals, 10)
+
+	err = info.Set("AC", []int{1, 2})
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+	err = info.Set("DP", []int{1, 2})
+	c.Assert(errors.Is(err, ErrWrongNumber), Equals, true)
+	err = info.Set("DP", "10")
+	c.Assert(errors.Is(err, ErrWrongType), Equals, true)
+	err = info.Set("NOPE", 1)
+	c.Assert(errors.Is(err, ErrNotDefined), Equals, true)
+}
+
+func (s *TSuite) TestAutoDeclareInfo(c *C) {
+	t, err := NewWithOptions("vt.norm.vcf.gz", Options{AutoDeclareInfo: true})
+	c.Assert(err, IsNil)
+	vs := t.Get(Position{"1", 50000, 90000})
+	a, b := vs[0].(*Variant).Info().(*INFO), vs[1].(*Variant).Info().(*INFO)
+
+	c.Assert(a.Set("NEWI", []int{1, 2}), IsNil)
+	c.Assert(a.Set("NEWF", true), IsNil)
+	c.Assert(b.Set("NEWI", []int{3}), IsNil)
+	c.Assert(t.AutoDeclared(), DeepEquals, []string{"NEWI", "NEWF"})
+	vals, _, err := b.GetInts("NEWI")
+	c.Assert(err, IsNil)
+	c.Assert(vals, DeepEquals, []int{3})
+
+	err = a.Set("BAD", struct{}{})
+	c.Assert(errors.Is(err, ErrWrongType), Equals, true)
+
+	u, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	info := u.Get(Position{"1", 54719, 54720})[0].(*Variant).Info().(*INFO)
+	err = info.Set("NEWI", 1)
+	c.Assert(errors.Is(err, ErrNotDefined), Equals, true)
+	c.Assert(u.AutoDeclared(), HasLen, 0)
+}
+
+func (s *TSuite) TestAutoDeclareConcurrent(c *C) {
+	t, err := NewWithOptions("vt.norm.vcf.gz", Options{AutoDeclareInfo: true})
+	c.Assert(err, IsNil)
+	vs := t.Get(Position{"1", 50000, 90000})
+	var wg sync.WaitGroup
+	errs := make([]error, len(vs))
+	for i, r := range vs {
+		wg.Add(1)
+		go func(i int, v *Variant) {
+			defer wg.Done()
+			errs[i] = v.Info().Set("SAME", i)
+		}(i, r.(*Variant))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		c.Assert(err, IsNil)
+	}
+	c.Assert(t.AutoDeclared(), DeepEquals, []string{"SAME"})
+	h, err := t.Header()
+	c.Assert(err, IsNil)
+	n := 0
+	for _, f := range h.Infos {
+		if f.ID == "SAME" {
+			n++
+		}
+	}
+	c.Assert(n, Equals, 1)
+}
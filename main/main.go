@@ -106,7 +106,6 @@ func doStuff(r interfaces.IVariant, n *int) interfaces.IVariant {
 	//log.Println(ov.Info.Get("culprit"))
 	//ov.Info.Set("culprit", "hi")
 	ov.Info().Set("DP", 23)
-	// TODO: update header then Set
 	v := []float32{33.0, 33.0, 44.0}
 	ov.Info().Set("many", v)
 	ov.Info().Set("flag", abool)
@@ -151,14 +150,11 @@ func benchmarkTabix(other string, ntimes int) {
 
 	var err error
 	for i := 0; i < ntimes; i++ {
-		tbxs[i], err = cgotabix.New(FS[i])
+		// the INFO fields set in doStuff are added to the header on first use.
+		tbxs[i], err = cgotabix.NewWithOptions(FS[i], cgotabix.Options{AutoDeclareInfo: true})
 		if err != nil {
 			log.Fatal(err)
 		}
-		tbxs[i].AddInfoToHeader("XXX", "1", "Float", "XXX")
-		tbxs[i].AddInfoToHeader("many", "3", "Float", "XXX")
-		tbxs[i].AddInfoToHeader("manyi", "3", "Integer", "XXX")
-		tbxs[i].AddInfoToHeader("flag", "1", "Flag", "XXX")
 	}
 
 	or, err := xopen.Ropen(other)
@@ -0,0 +1,99 @@
+package cgotabix
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brentp/irelate/interfaces"
+)
+
+// Record is a line from a tabix-indexed file of type OTHER. Its position is
+// taken from the sequence, begin and end columns stored in the index.
+type Record struct {
+	fields  []string
+	chrom   string
+	start   uint32
+	end     uint32
+	source  uint32
+	related []interfaces.Relatable
+}
+
+// NewRecord splits a tab-delimited line and finds its position using the
+// columns in p.
+func NewRecord(line string, p Preset) (*Record, error) {
+	fields := strings.Split(line, "\t")
+	if p.SeqCol < 1 || p.BeginCol < 1 || len(fields) < p.SeqCol || len(fields) < p.BeginCol || len(fields) < p.EndCol {
+		return nil, fmt.Errorf("too few columns for preset %+v", p)
+	}
+	begin, err := strconv.ParseUint(fields[p.BeginCol-1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	r := &Record{fields: fields, chrom: fields[p.SeqCol-1], source: 1}
+	// without TBX_UCSC the begin column is 1-based.
+	if p.Format&TBX_UCSC == 0 {
+		if begin == 0 {
+			return nil, fmt.Errorf("begin of 0 in 1-based column %d", p.BeginCol)
+		}
+		begin--
+	}
+	r.start, r.end = uint32(begin), uint32(begin+1)
+	if p.EndCol > 0 {
+		// an end column is the same whether the file is 0 or 1-based.
+		end, err := strconv.ParseUint(fields[p.EndCol-1], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		r.end = uint32(end)
+	}
+	return r, nil
+}
+
+func (r *Record) Chrom() string {
+	return r.chrom
+}
+
+func (r *Record) Start() uint32 {
+	return r.start
+}
+
+func (r *Record) End() uint32 {
+	return r.end
+}
+
+// Fields returns all columns of the line.
+func (r *Record) Fields() []string {
+	return r.fields
+}
+
+// Field returns the 0-based column i or "" if the line is shorter.
+func (r *Record) Field(i int) string {
+	if i < 0 || i >= len(r.fields) {
+		return ""
+	}
+	return r.fields[i]
+}
+
+func (r *Record) String() string {
+	return strings.Join(r.fields, "\t")
+}
+
+func (r *Record) Source() uint32 {
+	return r.source
+}
+
+func (r *Record) SetSource(s uint32) {
+	r.source = s
+}
+
+func (r *Record) Related() []interfaces.Relatable {
+	return r.related
+}
+
+func (r *Record) AddRelated(i interfaces.Relatable) {
+	if r.related == nil {
+		r.related = make([]interfaces.Relatable, 0)
+	}
+	r.related = append(r.related, i)
+}
@@ -0,0 +1,48 @@
+package cgotabix
+
+import (
+	"fmt"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestRecord(c *C) {
+	preset := Preset{Format: TBX_GENERIC, SeqCol: 1, BeginCol: 2, EndCol: 2, MetaChar: '#'}
+	path := filepath.Join(c.MkDir(), "scores.tsv.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Level: -1, Index: &preset})
+	c.Assert(err, IsNil)
+	fmt.Fprintf(w, "#chrom\tpos\tref\talt\tscore\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(w, "1\t%d\tA\tG\t%d.5\n", i*10, i)
+	}
+	c.Assert(w.Close(), IsNil)
+
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(t.Type(), Equals, OTHER)
+	res := t.Get(Position{"1", 19, 40})
+	c.Assert(res, HasLen, 3)
+	r := res[0].(*Record)
+	c.Assert(r.Start(), Equals, uint32(19))
+	c.Assert(r.End(), Equals, uint32(20))
+	c.Assert(r.Field(4), Equals, "2.5")
+	c.Assert(r.Field(5), Equals, "")
+
+	i := 0
+	for _ = range t.At("1:10-20") {
+		i += 1
+	}
+	c.Assert(i, Equals, 2)
+}
+
+func (s *TSuite) TestNewRecordUCSC(c *C) {
+	r, err := NewRecord("chr2\t0\t10\tx", PresetBED)
+	c.Assert(err, IsNil)
+	c.Assert(r.Chrom(), Equals, "chr2")
+	c.Assert(r.Start(), Equals, uint32(0))
+	c.Assert(r.End(), Equals, uint32(10))
+
+	_, err = NewRecord("chr2\t0", PresetGFF)
+	c.Assert(err, NotNil)
+}
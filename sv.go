@@ -0,0 +1,154 @@
+package cgotabix
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Breakend is the mate of a BND allele such as G]17:198982] or [13:123456[T.
+type Breakend struct {
+	// Chrom and Pos are the mate position; Pos is 0-based like Start.
+	Chrom string
+	Pos   uint32
+	// Sequence is the part of the allele outside the brackets.
+	Sequence string
+	// Before is true when the mate is joined before Sequence (]p]t and
+	// [p[t) rather than after it (t]p] and t[p[).
+	Before bool
+	// Right is true when the joined mate sequence extends to the right of
+	// Pos ('[') and false when it extends to the left (']').
+	Right bool
+}
+
+// parseBreakend parses a bracketed BND allele.
+func parseBreakend(alt string) (Breakend, bool) {
+	var b Breakend
+	i := strings.IndexAny(alt, "[]")
+	if i < 0 {
+		return b, false
+	}
+	bracket := alt[i]
+	j := strings.IndexByte(alt[i+1:], bracket)
+	if j < 0 {
+		return b, false
+	}
+	j += i + 1
+	mate := alt[i+1 : j]
+	k := strings.LastIndexByte(mate, ':')
+	if k < 1 {
+		return b, false
+	}
+	pos, err := strconv.ParseUint(mate[k+1:], 10, 32)
+	if err != nil || pos == 0 {
+		return b, false
+	}
+	b.Chrom, b.Pos = mate[:k], uint32(pos-1)
+	b.Right = bracket == '['
+	switch {
+	case i == 0:
+		b.Before, b.Sequence = true, alt[j+1:]
+	case j == len(alt)-1:
+		b.Sequence = alt[:i]
+	default:
+		return b, false
+	}
+	return b, b.Sequence != ""
+}
+
+// symbolicType returns the type of a symbolic allele such as <DEL:ME> ("DEL")
+// or "" if alt is not symbolic.
+func symbolicType(alt string) string {
+	if len(alt) < 3 || alt[0] != '<' || alt[len(alt)-1] != '>' {
+		return ""
+	}
+	t := alt[1 : len(alt)-1]
+	if i := strings.IndexByte(t, ':'); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+// SVType returns the SVTYPE INFO field or, if that is not set, the type of
+// the first symbolic or BND alternate allele. It is "" for other variants.
+func (c *Variant) SVType() string {
+	if info, ok := c.Info_.(*INFO); ok {
+		if t, err := info.GetString("SVTYPE"); err == nil {
+			return t
+		}
+	}
+	for _, alt := range c.Alt() {
+		if t := symbolicType(alt); t != "" {
+			return t
+		}
+		if _, ok := parseBreakend(alt); ok {
+			return "BND"
+		}
+	}
+	return ""
+}
+
+// SVLen returns the first value of the SVLEN INFO field.
+func (c *Variant) SVLen() (int, bool) {
+	info, ok := c.Info_.(*INFO)
+	if !ok {
+		return 0, false
+	}
+	vals, set, err := info.GetInts("SVLEN")
+	if err != nil || len(vals) == 0 || !set[0] {
+		return 0, false
+	}
+	return vals[0], true
+}
+
+// SVEnd returns the END INFO field. As END is 1-based and inclusive it is
+// also the 0-based, half-open end of the variant.
+func (c *Variant) SVEnd() (uint32, bool) {
+	info, ok := c.Info_.(*INFO)
+	if !ok {
+		return 0, false
+	}
+	end, err := info.GetInt("END")
+	if err != nil || end < 0 {
+		return 0, false
+	}
+	return uint32(end), true
+}
+
+// Breakends returns the mates of the BND alternate alleles.
+func (c *Variant) Breakends() []Breakend {
+	var bs []Breakend
+	for _, alt := range c.Alt() {
+		if b, ok := parseBreakend(alt); ok {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+// svEnd returns the end implied by SVLEN for symbolic deletions,
+// duplications, inversions and copy-number changes without an END.
+func (c *Variant) svEnd() (uint32, bool) {
+	spans := false
+	for _, alt := range c.Alt() {
+		switch symbolicType(alt) {
+		case "DEL", "DUP", "INV", "CNV":
+			spans = true
+		}
+	}
+	if !spans {
+		return 0, false
+	}
+	// htslib has already used END for the length of the reference allele.
+	if _, ok := c.SVEnd(); ok {
+		return 0, false
+	}
+	n, ok := c.SVLen()
+	if !ok {
+		return 0, false
+	}
+	if n < 0 {
+		n = -n
+	}
+	// the first base is the padding base before the event.
+	return c.Start() + 1 + uint32(n), true
+}
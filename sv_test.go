@@ -0,0 +1,85 @@
+package cgotabix
+
+import (
+	"fmt"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+const svVCF = `##fileformat=VCFv4.2
+##contig=<ID=1,length=1000000>
+##contig=<ID=2,length=1000000>
+##INFO=<ID=SVTYPE,Number=1,Type=String,Description="Type of structural variant">
+##INFO=<ID=SVLEN,Number=.,Type=Integer,Description="Length of structural variant">
+##INFO=<ID=END,Number=1,Type=Integer,Description="End position">
+##INFO=<ID=CIPOS,Number=2,Type=Integer,Description="Confidence interval around POS">
+##INFO=<ID=CIEND,Number=2,Type=Integer,Description="Confidence interval around END">
+##ALT=<ID=DEL,Description="Deletion">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+1	100	del1	A	<DEL>	.	.	SVTYPE=DEL;SVLEN=-50;CIPOS=-10,5;CIEND=-3,20
+1	200	del2	A	<DEL>	.	.	SVTYPE=DEL;END=260
+1	300	bnd1	G	G]2:500]	.	.	SVTYPE=BND
+1	400	bnd2	T	[2:600[T	.	.	.
+`
+
+func svVariants(c *C) []*Variant {
+	path := filepath.Join(c.MkDir(), "sv.vcf.gz")
+	w, err := NewBGZFWriter(path, &BGZFOptions{Index: &PresetVCF})
+	c.Assert(err, IsNil)
+	_, err = fmt.Fprint(w, svVCF)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	t, err := New(path)
+	c.Assert(err, IsNil)
+	var vs []*Variant
+	for _, r := range t.Get(Position{"1", 0, 1000}) {
+		vs = append(vs, r.(*Variant))
+	}
+	c.Assert(vs, HasLen, 4)
+	return vs
+}
+
+func (s *TSuite) TestStructuralVariants(c *C) {
+	vs := svVariants(c)
+
+	del := vs[0]
+	c.Assert(del.SVType(), Equals, "DEL")
+	n, ok := del.SVLen()
+	c.Assert(ok, Equals, true)
+	c.Assert(n, Equals, -50)
+	_, ok = del.SVEnd()
+	c.Assert(ok, Equals, false)
+	c.Assert(del.End(), Equals, uint32(150))
+	start, end, ok := del.CIPos()
+	c.Assert(ok, Equals, true)
+	c.Assert([]uint32{start, end}, DeepEquals, []uint32{89, 105})
+	start, end, ok = del.CIEnd()
+	c.Assert(ok, Equals, true)
+	c.Assert([]uint32{start, end}, DeepEquals, []uint32{146, 170})
+	c.Assert(del.Chrom(), Equals, "1")
+
+	end, ok = vs[1].SVEnd()
+	c.Assert(ok, Equals, true)
+	c.Assert(end, Equals, uint32(260))
+	c.Assert(vs[1].End(), Equals, uint32(260))
+	start, end, ok = vs[1].CIEnd()
+	c.Assert(ok, Equals, false)
+	c.Assert([]uint32{start, end}, DeepEquals, []uint32{259, 260})
+
+	c.Assert(vs[2].SVType(), Equals, "BND")
+	c.Assert(vs[2].Breakends(), DeepEquals, []Breakend{{Chrom: "2", Pos: 499, Sequence: "G"}})
+	c.Assert(vs[3].SVType(), Equals, "BND")
+	c.Assert(vs[3].Breakends(), DeepEquals, []Breakend{{Chrom: "2", Pos: 599, Sequence: "T", Before: true, Right: true}})
+	c.Assert(vs[3].End(), Equals, uint32(400))
+}
+
+func (s *TSuite) TestParseBreakend(c *C) {
+	for _, alt := range []string{"A", "<DEL>", "G]2:500", "]2:500]", "G]2500]", "G]2:0]", "G]2:5]T"} {
+		_, ok := parseBreakend(alt)
+		c.Assert(ok, Equals, false, Commentf(alt))
+	}
+	b, ok := parseBreakend("]HLA-A*01:01:01:01:100]AC")
+	c.Assert(ok, Equals, true)
+	c.Assert(b, DeepEquals, Breakend{Chrom: "HLA-A*01:01:01:01", Pos: 99, Sequence: "AC", Before: true})
+}
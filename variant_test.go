@@ -0,0 +1,69 @@
+package cgotabix
+
+import (
+	"errors"
+	"runtime"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestEditVariant(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	c.Assert(t.AddFilterToHeader("LowQ", "low quality"), IsNil)
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+
+	c.Assert(v.SetId("rs123"), IsNil)
+	c.Assert(v.Id(), Equals, "rs123")
+
+	q, ok := v.Qual()
+	c.Assert(ok, Equals, true)
+	c.Assert(q > 1508 && q < 1509, Equals, true)
+	v.SetQual(20)
+	q, _ = v.Qual()
+	c.Assert(q, Equals, float32(20))
+	v.SetQualMissing()
+	_, ok = v.Qual()
+	c.Assert(ok, Equals, false)
+
+	c.Assert(v.Filters(), HasLen, 0)
+	c.Assert(v.IsPass(), Equals, true)
+	c.Assert(v.SetFilters("LowQ"), IsNil)
+	c.Assert(v.Filters(), DeepEquals, []string{"LowQ"})
+	c.Assert(v.IsPass(), Equals, false)
+	c.Assert(v.HasFilter("LowQ"), Equals, true)
+	c.Assert(v.SetFilters("Undefined"), NotNil)
+	c.Assert(v.SetFilters(), IsNil)
+	c.Assert(v.Filters(), HasLen, 0)
+
+	c.Assert(v.Alt(), DeepEquals, []string{"C"})
+	c.Assert(v.SetAlt([]string{"G", "CTTT"}), IsNil)
+	c.Assert(v.Alt(), DeepEquals, []string{"G", "CTTT"})
+	c.Assert(v.SetRef("CTTA"), IsNil)
+	c.Assert(v.Ref(), Equals, "CTTA")
+	c.Assert(v.End(), Equals, v.Start()+4)
+	c.Assert(v.SetAlt([]string{""}), NotNil)
+
+	c.Assert(v.SetPos(100), IsNil)
+	c.Assert(v.Start(), Equals, uint32(99))
+	c.Assert(v.Pos, Equals, uint64(100))
+}
+
+func (s *TSuite) TestTranslate(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	c.Assert(t.AddInfoToHeader("NEW", "1", "Integer", "new"), IsNil)
+	runtime.GC()
+	// v still uses the header it was read with.
+	c.Assert(v.Info().String(), Not(Equals), "")
+	err = v.Info().Set("NEW", 1)
+	c.Assert(errors.Is(err, ErrNotDefined), Equals, true)
+
+	c.Assert(v.Translate(t), IsNil)
+	c.Assert(v.Info().Set("NEW", 1), IsNil)
+	n, err := v.Info().(*INFO).GetInt("NEW")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(v.Chrom(), Equals, "1")
+}
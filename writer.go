@@ -0,0 +1,127 @@
+package cgotabix
+
+/*
+#include "stdlib.h"
+#include "htslib/hts.h"
+#include "htslib/vcf.h"
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// OutputFormat is the format written by a Writer. Its value is the htslib
+// open mode.
+type OutputFormat string
+
+const (
+	OutputVCF   OutputFormat = "w"
+	OutputVCFGZ OutputFormat = "wz"
+	OutputBCF   OutputFormat = "wb"
+)
+
+// Writer writes Variants as VCF, bgzipped VCF or BCF.
+type Writer struct {
+	path string
+	htf  *C.htsFile
+	// hdr is copied from t and written by the first Write or by Close.
+	hdr *C.bcf_hdr_t
+	t   *Tabix
+}
+
+func writerCloser(w *Writer) {
+	if w.htf != nil {
+		C.hts_close(w.htf)
+	}
+	if w.hdr != nil {
+		C.bcf_hdr_destroy(w.hdr)
+	}
+}
+
+// NewWriter creates path ("-" for stdout). The header of t, including any
+// lines added with AddInfoToHeader or declared by INFO.Set, is copied and
+// written when the first Variant is written. From then on no lines can be
+// added to the header of t: AddInfoToHeader returns a HeaderError and
+// INFO.Set returns ErrHeaderWritten for a key it would declare.
+func NewWriter(path string, t *Tabix, format OutputFormat) (*Writer, error) {
+	t.mu.RLock()
+	closed, hdr := t.closed, t.hdr
+	t.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if hdr == nil {
+		return nil, fmt.Errorf("cgotabix: %s has no VCF header to write", t.path)
+	}
+	switch format {
+	case OutputVCF, OutputVCFGZ, OutputBCF:
+	default:
+		return nil, fmt.Errorf("cgotabix: unknown output format %q", format)
+	}
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	cmode := C.CString(string(format))
+	defer C.free(unsafe.Pointer(cmode))
+
+	w := &Writer{path: path, t: t}
+	w.htf = C.hts_open(cs, cmode)
+	if w.htf == nil {
+		return nil, fmt.Errorf("cgotabix: unable to open %s for writing", path)
+	}
+	runtime.SetFinalizer(w, writerCloser)
+	return w, nil
+}
+
+func (w *Writer) writeHeader() error {
+	w.t.mu.Lock()
+	w.t.headerWritten = true
+	w.hdr = C.bcf_hdr_dup(w.t.hdr)
+	w.t.mu.Unlock()
+	if C.bcf_hdr_write(w.htf, w.hdr) != 0 {
+		return fmt.Errorf("cgotabix: error writing header to %s", w.path)
+	}
+	return nil
+}
+
+// Write writes the full record of v.
+func (w *Writer) Write(v *Variant) error {
+	if w.htf == nil {
+		return errClosedWriter
+	}
+	if w.hdr == nil {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if C.bcf_write(w.htf, w.hdr, v.v) != 0 {
+		return fmt.Errorf("cgotabix: error writing %s:%d to %s", v.Chrom(), v.Start()+1, w.path)
+	}
+	return nil
+}
+
+// Close flushes and closes the output. Calling Close more than once is a no-op.
+func (w *Writer) Close() error {
+	if w.htf == nil {
+		return nil
+	}
+	var err error
+	if w.hdr == nil {
+		err = w.writeHeader()
+	}
+	ret := C.hts_close(w.htf)
+	w.htf = nil
+	if w.hdr != nil {
+		C.bcf_hdr_destroy(w.hdr)
+		w.hdr = nil
+	}
+	runtime.SetFinalizer(w, nil)
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return fmt.Errorf("cgotabix: error closing %s", w.path)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cgotabix
+
+import (
+	"errors"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *TSuite) TestWriter(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	path := filepath.Join(c.MkDir(), "out.vcf.gz")
+	w, err := NewWriter(path, t, OutputVCFGZ)
+	c.Assert(err, IsNil)
+	for r := range t.At("1:50000-90000") {
+		c.Assert(w.Write(r.(*Variant)), IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	c.Assert(BuildIndex(path, PresetVCF), IsNil)
+
+	o, err := New(path)
+	c.Assert(err, IsNil)
+	c.Assert(o.Get(Position{"1", 0, 1000000}), HasLen, 15)
+}
+
+func (s *TSuite) TestWriterFormats(c *C) {
+	t, err := New("vt.norm.vcf.gz")
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	for _, f := range []OutputFormat{OutputVCF, OutputBCF} {
+		w, err := NewWriter(filepath.Join(dir, "out"), t, f)
+		c.Assert(err, IsNil)
+		for _, r := range t.Get(Position{"1", 50000, 90000}) {
+			c.Assert(w.Write(r.(*Variant)), IsNil)
+		}
+		c.Assert(w.Close(), IsNil)
+	}
+	_, err = NewWriter(filepath.Join(dir, "out"), t, OutputFormat("r"))
+	c.Assert(err, NotNil)
+}
+
+func (s *TSuite) TestWriterAutoDeclare(c *C) {
+	t, err := NewWithOptions("vt.norm.vcf.gz", Options{AutoDeclareInfo: true})
+	c.Assert(err, IsNil)
+	path := filepath.Join(c.MkDir(), "out.vcf.gz")
+	w, err := NewWriter(path, t, OutputVCFGZ)
+	c.Assert(err, IsNil)
+	for _, r := range t.Get(Position{"1", 50000, 90000}) {
+		v := r.(*Variant)
+		c.Assert(v.Info().Set("SCORE", 0.5), IsNil)
+		c.Assert(v.Info().Set("TAGS", []string{"a", "b"}), IsNil)
+		c.Assert(w.Write(v), IsNil)
+	}
+	// the header is written: new keys must have been declared up front.
+	v := t.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	err = v.Info().Set("LATE", true)
+	c.Assert(errors.Is(err, ErrHeaderWritten), Equals, true)
+	c.Assert(t.AddInfoToHeader("LATE", "0", "Flag", "late"), NotNil)
+	c.Assert(v.Info().Set("SCORE", 1.5), IsNil)
+	c.Assert(w.Close(), IsNil)
+	c.Assert(t.AutoDeclared(), DeepEquals, []string{"SCORE", "TAGS"})
+	c.Assert(BuildIndex(path, PresetVCF), IsNil)
+
+	o, err := New(path)
+	c.Assert(err, IsNil)
+	h, err := o.Header()
+	c.Assert(err, IsNil)
+	score, ok := h.Info("SCORE")
+	c.Assert(ok, Equals, true)
+	c.Assert(score, DeepEquals, FieldDef{ID: "SCORE", Number: "1", Type: "Float", Description: "Added by cgotabix"})
+	tags, _ := h.Info("TAGS")
+	c.Assert(tags.Number, Equals, ".")
+	v = o.Get(Position{"1", 54719, 54720})[0].(*Variant)
+	vals, _, err := v.Info().(*INFO).GetStrings("TAGS")
+	c.Assert(err, IsNil)
+	c.Assert(vals, DeepEquals, []string{"a", "b"})
+}